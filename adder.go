@@ -1,7 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -13,6 +16,11 @@ func init() {
 	commandHandlers["add-dialogs"] = AddDialogs
 	commandHandlers["add-aacs"] = AddAACs
 	commandHandlers["add-words-with-text"] = AddWordsWithText
+	commandHandlers["add-typed"] = AddTyped
+	commandHandlers["transcribe"] = Transcribe
+	commandHandlers["add-dictations"] = AddDictations
+	commandHandlers["add-choices"] = AddChoices
+	commandHandlers["add-cards"] = AddCards
 }
 
 func AddWordsWithText(data *Data, args []string) {
@@ -230,3 +238,173 @@ func AddDialogs(data *Data, args []string) {
 		}
 	}
 }
+
+// AddTyped adds typed entries for words with text
+func AddTyped(data *Data, args []string) {
+	for index, word := range data.Words {
+		if strings.TrimSpace(word.Text) == "" {
+			continue
+		}
+		entry := &TypedWordEntry{
+			WordIndex: index,
+			word:      word,
+			HistoryImpl: &HistoryImpl{
+				History: []HistoryEntry{
+					{
+						Level: 0,
+						Time:  time.Now(),
+					},
+				},
+			},
+		}
+		if data.AddEntry(entry) {
+			p("added TypedWordEntry %s\n", word.AudioFile)
+		}
+	}
+}
+
+// Transcribe sets the transcript of a sentence, or asks for the missing ones
+func Transcribe(data *Data, args []string) {
+	if len(args) > 1 {
+		audioFile, err := filepath.Abs(args[0])
+		if err != nil {
+			log.Fatalf("Transcribe: wrong audio file path %v", err)
+		}
+		audioFile = strings.TrimPrefix(audioFile, filepath.Join(rootPath, "files"))
+		data.Transcripts[audioFile] = strings.Join(args[1:], " ")
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for _, e := range data.Practices {
+		sentence, ok := e.(*SentenceEntry)
+		if !ok || data.Transcripts[sentence.AudioFile] != "" {
+			continue
+		}
+		p("%s\n", sentence.AudioFile)
+		playAudio(sentence.AudioFile)
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			data.Transcripts[sentence.AudioFile] = text
+			data.save()
+		}
+	}
+}
+
+// AddDictations adds dictation entries for sentences with transcripts
+func AddDictations(data *Data, args []string) {
+	for _, e := range data.Practices {
+		sentence, ok := e.(*SentenceEntry)
+		if !ok || data.Transcripts[sentence.AudioFile] == "" {
+			continue
+		}
+		entry := &DictationEntry{
+			AudioFile:  sentence.AudioFile,
+			transcript: data.Transcripts[sentence.AudioFile],
+			HistoryImpl: &HistoryImpl{
+				History: []HistoryEntry{
+					{
+						Level: 0,
+						Time:  time.Now(),
+					},
+				},
+			},
+		}
+		if data.AddEntry(entry) {
+			p("added DictationEntry %s\n", sentence.AudioFile)
+		}
+	}
+}
+
+// AddChoices adds multiple-choice entries for words with text
+func AddChoices(data *Data, args []string) {
+	texts := make(map[string]bool)
+	for _, word := range data.Words {
+		if text := strings.TrimSpace(word.Text); text != "" {
+			texts[text] = true
+		}
+	}
+	if len(texts) < choiceCount {
+		log.Fatalf("AddChoices: not enough words with text for %d choices", choiceCount)
+	}
+	for index, word := range data.Words {
+		if strings.TrimSpace(word.Text) == "" {
+			continue
+		}
+		entry := &ChoiceEntry{
+			WordIndex: index,
+			HistoryImpl: &HistoryImpl{
+				History: []HistoryEntry{
+					{
+						Level: 0,
+						Time:  time.Now(),
+					},
+				},
+			},
+		}
+		entry.Init(data)
+		if data.AddEntry(entry) {
+			p("added ChoiceEntry %s\n", word.AudioFile)
+		}
+	}
+}
+
+// AddCards adds text cards from tab separated files of front, back and an optional lesson
+func AddCards(data *Data, args []string) {
+	for _, path := range args {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("AddCards: read %s error: %v", path, err)
+		}
+		source, err := filepath.Abs(path)
+		if err != nil {
+			log.Fatalf("AddCards: wrong card file path %v", err)
+		}
+		source = strings.TrimPrefix(source, filepath.Join(rootPath, "files"))
+		cards, err := parseCards(string(content), source)
+		if err != nil {
+			log.Fatalf("AddCards: %s:%v", path, err)
+		}
+		for _, entry := range cards {
+			if data.AddEntry(entry) {
+				p("added TextCardEntry %s\n", entry.Front)
+			} else {
+				p("skip %s\n", entry.Front)
+			}
+		}
+	}
+}
+
+func parseCards(content, source string) ([]*TextCardEntry, error) {
+	var cards []*TextCardEntry
+	for n, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%d: expected front and back separated by tab", n+1)
+		}
+		entry := &TextCardEntry{
+			Front:  strings.TrimSpace(fields[0]),
+			Back:   strings.TrimSpace(fields[1]),
+			Source: source,
+			HistoryImpl: &HistoryImpl{
+				History: []HistoryEntry{
+					{
+						Level: 0,
+						Time:  time.Now(),
+					},
+				},
+			},
+		}
+		if len(fields) > 2 {
+			entry.LessonName = strings.TrimSpace(fields[2])
+		}
+		cards = append(cards, entry)
+	}
+	return cards, nil
+}
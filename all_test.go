@@ -2,9 +2,635 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 )
 
 func TestRuneWidth(t *testing.T) {
 	fmt.Printf("%x %d\n", 'て', runeWidth('て'))
 }
+
+func TestBalancer(t *testing.T) {
+	now := time.Date(2015, 1, 3, 12, 0, 0, 0, time.UTC)
+	adjust := func(seed int64) []time.Duration {
+		b := NewBalancer(seed, 0.05, 0.1, dayNumber)
+		for i := 0; i < 5; i++ {
+			b.Add(now.Add(time.Hour * 24 * 30))
+		}
+		var ret []time.Duration
+		for i := 0; i < 10; i++ {
+			ret = append(ret, b.Adjust(now, time.Hour*24*30))
+		}
+		return ret
+	}
+	a, b := adjust(1), adjust(1)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("not deterministic: %v %v", a, b)
+		}
+		if dayNumber(now.Add(a[i])) == dayNumber(now.Add(time.Hour*24*30)) {
+			t.Fatalf("not balanced away from loaded day: %v", a[i])
+		}
+	}
+}
+
+func TestStudyDay(t *testing.T) {
+	day, err := Config{
+		DayStart: "04:00",
+		Timezone: "Asia/Tokyo",
+	}.studyDay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	late := time.Date(2015, 1, 3, 3, 30, 0, 0, tokyo)
+	if day.Date(late) != "2015-01-02" {
+		t.Fatalf("got %s", day.Date(late))
+	}
+	if day.Number(late) != day.Number(late.Add(-time.Hour*20)) {
+		t.Fatal("should be the same study day")
+	}
+	if day.Number(late) == day.Number(late.Add(time.Hour)) {
+		t.Fatal("should be the next study day")
+	}
+}
+
+func TestLessonRule(t *testing.T) {
+	rule, err := parseLessonRule(`regexp:book(?P<book>\d+)/unit(?P<unit>\d+)/(?P<lesson>\d+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lesson := rule("/book2/unit03/05 foo.mp3")
+	if lesson.String() != "2/03/05" {
+		t.Fatalf("got %s", lesson)
+	}
+	if !lesson.HasPrefix(ParseLesson("2/3")) {
+		t.Fatal("should match prefix")
+	}
+	if ParseLesson("9").Compare(ParseLesson("10")) >= 0 {
+		t.Fatal("9 should sort before 10")
+	}
+	if ParseLesson("2/unit9").Compare(ParseLesson("2/unit10")) >= 0 {
+		t.Fatal("unit9 should sort before unit10")
+	}
+	rule, _ = parseLessonRule("dirs:2")
+	if lesson := rule("/book2/unit03/05 foo.mp3"); lesson.String() != "book2/unit03" {
+		t.Fatalf("got %s", lesson)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	parts := diffRunes("日本語", "日本")
+	if editDistance(parts) != 1 || parts[2].Op != DIFF_MISSING {
+		t.Fatalf("got %v", parts)
+	}
+	if suggestGrade(parts, 3) != AGAIN {
+		t.Fatal("expected again")
+	}
+	expected, actual := Diff{Parts: parts}.rows()
+	if len(expected) != 3 || len(actual) != 4 {
+		t.Fatalf("got %v %v", expected, actual)
+	}
+	if suggestGrade(diffRunes("language", "langauge"), 8) != HARD {
+		t.Fatal("expected hard")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	if got := tokenize("Hello, world! 你好"); !reflect.DeepEqual(got, []string{"hello", "world", "你", "好"}) {
+		t.Fatalf("got %v", got)
+	}
+	parts := diffTokens(tokenize("the cat sat down"), tokenize("the cat sit down here"))
+	if parts[2].Op != DIFF_WRONG || parts[4].Op != DIFF_EXTRA {
+		t.Fatalf("got %v", parts)
+	}
+}
+
+func TestCloze(t *testing.T) {
+	text, spans := markedSpans("I {{like}} green {{tea}}.")
+	if text != "I like green tea." || len(spans) != 2 || text[spans[1].start:spans[1].end] != "tea" {
+		t.Fatalf("got %q %v", text, spans)
+	}
+	data := &Data{
+		Words: []*Word{{Text: "tea"}, {Text: "green tea"}, {Text: "a"}},
+	}
+	spans = data.wordSpans("A green tea, a teapot")
+	if len(spans) != 3 || spans[1] != (span{2, 11}) {
+		t.Fatalf("got %v", spans)
+	}
+}
+
+func TestDistractors(t *testing.T) {
+	data := &Data{}
+	for _, path := range []string{"1/a 一", "1/b 二", "2/a 三", "3/a 四", "9/a 五", "9/b 五"} {
+		data.Words = append(data.Words, &Word{AudioFile: path, Text: path[4:]})
+	}
+	got := data.distractors(0, 3)
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v", got)
+	}
+	if got := data.distractors(4, 5); len(got) != 4 {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func testData(config Config) *Data {
+	data := &Data{
+		Config:       config,
+		SignatureSet: make(map[string]struct{}),
+	}
+	data.scheduler = data.newScheduler()
+	data.initStudyDay()
+	return data
+}
+
+func testEntry(history ...HistoryEntry) PracticeEntry {
+	return &AudioToWordEntry{
+		HistoryImpl: &HistoryImpl{
+			History: history,
+		},
+		word: &Word{},
+	}
+}
+
+func TestLapsePolicy(t *testing.T) {
+	for policy, want := range map[string]int{"reset": 0, "drop": 8, "halve": 5} {
+		data := testData(Config{LapsePolicy: policy})
+		e := testEntry(HistoryEntry{
+			Level:    10,
+			Time:     time.Now().Add(-time.Hour * 24),
+			Interval: time.Hour * 24,
+			Grade:    GOOD,
+		})
+		for i := 0; i < 3; i++ {
+			data.Answer(e, AGAIN, 0)
+			if h := e.LastHistory(); h.Level != want || !h.Relearning || h.Interval != 0 {
+				t.Fatalf("%s: failure %d got %+v", policy, i, h)
+			}
+		}
+	}
+}
+
+func TestLapses(t *testing.T) {
+	now := time.Now()
+	e := testEntry(
+		HistoryEntry{Time: now},
+		HistoryEntry{Time: now, Grade: AGAIN},
+		HistoryEntry{Time: now, Level: 1, Grade: GOOD},
+		HistoryEntry{Time: now, Level: 1, Note: "vacation"},
+		HistoryEntry{Time: now, Level: 1, Grade: AGAIN, Relearning: true},
+		HistoryEntry{Time: now, Level: 1, Grade: AGAIN, Relearning: true},
+		HistoryEntry{Time: now, Level: 2, Grade: GOOD},
+		HistoryEntry{Time: now, Level: 0, Grade: AGAIN, Relearning: true},
+	)
+	if n := lapses(e); n != 2 {
+		t.Fatalf("got %d lapses", n)
+	}
+}
+
+func TestFSRSWeightsChange(t *testing.T) {
+	now := time.Now()
+	e := testEntry(
+		HistoryEntry{Time: now.Add(-time.Hour * 48)},
+		HistoryEntry{Time: now.Add(-time.Hour * 24), Level: 1, Grade: GOOD},
+	)
+	s := &FSRSScheduler{Weights: fsrsDefaultWeights, Retention: 0.9}
+	before := s.memory(e).Stability
+	weights := append([]float64(nil), fsrsDefaultWeights...)
+	weights[2] *= 2
+	s = &FSRSScheduler{Weights: weights, Retention: 0.9}
+	if after := s.memory(e).Stability; after != before*2 {
+		t.Fatalf("cached stability %v not replayed, was %v", after, before)
+	}
+}
+
+func TestLearningSteps(t *testing.T) {
+	data := testData(Config{})
+	now := time.Now()
+	e := testEntry(HistoryEntry{Time: now.Add(-time.Hour)})
+	data.Practices = append(data.Practices, e)
+	data.answerStep(e, AGAIN, time.Second, time.Minute)
+	if entryState(e) != STATE_LEARNING || lapses(e) != 0 {
+		t.Fatalf("got state %v", entryState(e))
+	}
+	if newWeight, _ := data.weightOn(now); newWeight != e.Weight() {
+		t.Fatalf("step answer not charged to the new budget: %d", newWeight)
+	}
+	if data.isDue(e, now) || !data.isDue(e, now.Add(time.Minute*2)) {
+		t.Fatal("should be due after the step")
+	}
+	data.Answer(e, GOOD, time.Second)
+	if h := e.LastHistory(); h.Level != 1 || h.Interval < time.Hour*20 {
+		t.Fatalf("graduated to %+v", h)
+	}
+
+	fsrs := &FSRSScheduler{Weights: fsrsDefaultWeights, Retention: 0.9}
+	if m := fsrs.memory(e); m.Stability >= fsrsDefaultWeights[GOOD-AGAIN] {
+		t.Fatalf("failed step not replayed: %+v", m)
+	}
+}
+
+func TestTopLevel(t *testing.T) {
+	for _, scheduler := range []string{"level", "sm2", "fsrs"} {
+		for _, level := range []int{11, 12} {
+			for _, res := range []PracticeResult{GOOD, EASY} {
+				data := testData(Config{Scheduler: scheduler})
+				e := testEntry(
+					HistoryEntry{Time: time.Now().Add(-time.Hour * 24 * 400)},
+					HistoryEntry{
+						Level:    level,
+						Time:     time.Now().Add(-time.Hour * 24 * 300),
+						Interval: time.Hour * 24 * 300,
+						Grade:    GOOD,
+					},
+				)
+				data.Answer(e, res, 0)
+				h := e.LastHistory()
+				mastered := scheduler == "level" && (level == 12 || res == EASY)
+				if mastered != (entryState(e) == STATE_MASTERED) || h.Level > topLevel+1 {
+					t.Fatalf("%s level %d grade %d: got %+v", scheduler, level, res, h)
+				}
+				if !mastered && h.Interval <= 0 {
+					t.Fatalf("%s level %d grade %d: no interval", scheduler, level, res)
+				}
+			}
+		}
+	}
+}
+
+func TestNewEntryFactor(t *testing.T) {
+	data := testData(Config{ThrottleOverdue: 2, PauseOverdue: 4, ThrottleForecast: 10})
+	now := time.Now()
+	review := func(late float64) EntryInfo {
+		return EntryInfo{
+			PracticeEntry: testEntry(HistoryEntry{Time: now}, HistoryEntry{Level: 3, Time: now, Interval: time.Hour * 24}),
+			late:          late,
+		}
+	}
+	due := []EntryInfo{review(1), review(1), review(1), review(-0.5), {PracticeEntry: testEntry(HistoryEntry{Time: now})}}
+	factor, overdue, _ := data.newEntryFactor(due, nil)
+	if overdue != 3 || factor != 0.5 {
+		t.Fatalf("got factor %v with %d overdue", factor, overdue)
+	}
+	for i := 0; i < 15; i++ {
+		data.Practices = append(data.Practices, review(0).PracticeEntry)
+	}
+	factor, _, forecast := data.newEntryFactor(nil, nil)
+	if forecast != 15 || factor != 0.5 {
+		t.Fatalf("got factor %v with %d forecast", factor, forecast)
+	}
+	if _, _, forecast := data.newEntryFactor(nil, []string{"1"}); forecast != 0 {
+		t.Fatalf("forecast %d outside lessons", forecast)
+	}
+}
+
+// reviewed returns an entry at level, last answered ago with the scheduled interval
+func reviewed(level int, interval, ago time.Duration) PracticeEntry {
+	now := time.Now()
+	return testEntry(
+		HistoryEntry{Time: now.Add(-ago - time.Hour*24)},
+		HistoryEntry{Level: level, Time: now.Add(-ago), Interval: interval, Grade: GOOD},
+	)
+}
+
+func near(a, b time.Duration) bool {
+	return a-b < time.Minute && b-a < time.Minute
+}
+
+func TestLevelScheduler(t *testing.T) {
+	levelTime := NewLevelScheduler(time.Hour*24, 2.2).LevelTime
+	for res, want := range map[PracticeResult]int{HARD: 3, GOOD: 4, EASY: 5} {
+		data := testData(Config{Fuzz: -1, BalanceWindow: -1})
+		e := reviewed(3, levelTime[3], levelTime[3])
+		data.Answer(e, res, 0)
+		if h := e.LastHistory(); h.Level != want || !near(h.Interval, levelTime[want]) || h.Grade != res {
+			t.Fatalf("grade %d: got %+v", res, h)
+		}
+	}
+	data := testData(Config{Fuzz: -1, BalanceWindow: -1})
+	e := reviewed(3, levelTime[3], levelTime[3])
+	data.Answer(e, AGAIN, 0)
+	if h := e.LastHistory(); h.Level != 0 || !h.Relearning || h.Interval != 0 {
+		t.Fatalf("again: got %+v", h)
+	}
+	data.Answer(e, GOOD, 0)
+	if h := e.LastHistory(); h.Level != 1 || h.Relearning || !near(h.Interval, levelTime[1]) {
+		t.Fatalf("relearned: got %+v", h)
+	}
+}
+
+func TestSM2Scheduler(t *testing.T) {
+	day := time.Hour * 24
+	for res, want := range map[PracticeResult]struct {
+		ease     float64
+		interval time.Duration
+	}{
+		HARD: {2.36, time.Duration(float64(6*day) * 2.36 / 2)},
+		GOOD: {2.5, time.Duration(float64(6*day) * 2.5)},
+		EASY: {2.6, time.Duration(float64(6*day) * 2.6 * 1.3)},
+	} {
+		data := testData(Config{Scheduler: "sm2", Fuzz: -1, BalanceWindow: -1})
+		e := reviewed(3, 6*day, 6*day)
+		e.SetEase(2.5)
+		data.Answer(e, res, 0)
+		h := e.LastHistory()
+		if h.Level != 4 || !near(h.Interval, want.interval) || math.Abs(e.GetEase()-want.ease) > 1e-9 {
+			t.Fatalf("grade %d: got %+v ease %v", res, h, e.GetEase())
+		}
+	}
+	data := testData(Config{Scheduler: "sm2", Fuzz: -1, BalanceWindow: -1})
+	e := reviewed(3, 6*day, 6*day)
+	e.SetEase(1.4)
+	data.Answer(e, AGAIN, 0)
+	if h := e.LastHistory(); h.Level != 0 || !h.Relearning || e.GetEase() != sm2MinEase {
+		t.Fatalf("again: got %+v ease %v", h, e.GetEase())
+	}
+}
+
+func TestFSRSScheduler(t *testing.T) {
+	intervals := make(map[PracticeResult]time.Duration)
+	for _, res := range []PracticeResult{HARD, GOOD, EASY} {
+		data := testData(Config{Scheduler: "fsrs", Fuzz: -1, BalanceWindow: -1})
+		e := reviewed(3, time.Hour*24*10, time.Hour*24*10)
+		data.Answer(e, res, 0)
+		h := e.LastHistory()
+		if h.Level != 4 || e.GetMemory().Reviews != len(e.GetHistory()) {
+			t.Fatalf("grade %d: got %+v memory %+v", res, h, e.GetMemory())
+		}
+		intervals[res] = h.Interval
+	}
+	if !(intervals[HARD] < intervals[GOOD] && intervals[GOOD] < intervals[EASY]) {
+		t.Fatalf("intervals not ordered by grade: %v", intervals)
+	}
+	data := testData(Config{Scheduler: "fsrs", Fuzz: -1, BalanceWindow: -1})
+	e := reviewed(3, time.Hour*24*10, time.Hour*24*10)
+	stability := data.scheduler.(*FSRSScheduler).memory(e).Stability
+	data.Answer(e, AGAIN, 0)
+	if h := e.LastHistory(); h.Level != 0 || !h.Relearning || e.GetMemory().Stability >= stability {
+		t.Fatalf("again: got %+v memory %+v", h, e.GetMemory())
+	}
+}
+
+func TestWeightOn(t *testing.T) {
+	data := testData(Config{})
+	now := time.Now()
+	yesterday := now.Add(-time.Hour * 24)
+	data.Practices = []PracticeEntry{
+		testEntry(HistoryEntry{Time: yesterday}),                                        // never answered
+		testEntry(HistoryEntry{Time: yesterday}, HistoryEntry{Time: now, Grade: AGAIN}), // introduced today
+		testEntry(HistoryEntry{Time: yesterday}, HistoryEntry{Time: yesterday, Level: 1},
+			HistoryEntry{Time: now, Level: 2}), // reviewed today
+		testEntry(HistoryEntry{Time: yesterday}, HistoryEntry{Time: yesterday, Level: 1}), // not today
+	}
+	if newWeight, reviewWeight := data.weightOn(now); newWeight != 10 || reviewWeight != 10 {
+		t.Fatalf("got new %d review %d", newWeight, reviewWeight)
+	}
+}
+
+func TestVacation(t *testing.T) {
+	data := testData(Config{})
+	day := time.Hour * 24
+	e := reviewed(3, 10*day, 7*day) // due in 3 days
+	data.Practices = []PracticeEntry{e}
+	due := data.due(e)
+	now := time.Now()
+	Vacation(data, []string{now.Add(day).Format("2006-01-02"), now.Add(5 * day).Format("2006-01-02")})
+	if h := e.LastHistory(); !h.synthetic() || !data.due(e).Equal(due.Add(5*day)) || h.Level != 3 {
+		t.Fatalf("got %+v", h)
+	}
+	if lapses(e) != 0 || len(data.collectReviews()) != 0 {
+		t.Fatal("synthetic entry counted as an answer")
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	data := testData(Config{})
+	day := time.Hour * 24
+	for i := 0; i < 4; i++ {
+		data.Practices = append(data.Practices, reviewed(3, 2*day, 10*day))
+	}
+	Reschedule(data, []string{"2"})
+	stillDue := 0
+	for _, e := range data.Practices {
+		if data.isDue(e, time.Now()) {
+			stillDue++
+		} else if !data.isDue(e, time.Now().Add(day)) {
+			t.Fatalf("moved too far: %v", data.due(e))
+		}
+	}
+	if stillDue != 2 {
+		t.Fatalf("%d still due", stillDue)
+	}
+}
+
+func TestLateAnswers(t *testing.T) {
+	levelTime := NewLevelScheduler(time.Hour*24, 2.2).LevelTime
+	data := testData(Config{Fuzz: -1, BalanceWindow: -1})
+	e := reviewed(3, levelTime[3], levelTime[3]*2)
+	data.Answer(e, GOOD, 0)
+	if h := e.LastHistory(); !near(h.Interval, time.Duration(float64(levelTime[4])*1.5)) {
+		t.Fatalf("late recall credited to %v", h.Interval)
+	}
+
+	day := time.Hour * 24
+	for vacation, want := range map[time.Duration]time.Duration{0: 25 * day, 10 * day: 25 * day} {
+		data = testData(Config{Scheduler: "sm2", Fuzz: -1, BalanceWindow: -1})
+		e = reviewed(3, 10*day, 10*day+vacation)
+		if vacation > 0 {
+			moveDue(e, e.LastHistory().Time.Add(10*day+vacation), "vacation")
+		}
+		e.SetEase(2.5)
+		data.Answer(e, GOOD, 0)
+		if h := e.LastHistory(); !near(h.Interval, want) {
+			t.Fatalf("sm2 after %v vacation: got %v", vacation, h.Interval)
+		}
+	}
+	data = testData(Config{Scheduler: "sm2", Fuzz: -1, BalanceWindow: -1})
+	e = reviewed(3, 10*day, 20*day)
+	e.SetEase(2.5)
+	data.Answer(e, GOOD, 0)
+	if h := e.LastHistory(); !near(h.Interval, time.Duration(float64(15*day)*2.5)) {
+		t.Fatalf("sm2 late recall credited to %v", h.Interval)
+	}
+
+	data = testData(Config{LapsePolicy: "drop", LatePenalty: 2})
+	e = reviewed(10, levelTime[10], levelTime[10]*2)
+	data.Answer(e, AGAIN, 0)
+	if h := e.LastHistory(); h.Level != 7 { // dropped 2, then 1 for being 0.9 intervals overdue
+		t.Fatalf("failed overdue at level %d", h.Level)
+	}
+}
+
+func TestDailyBudget(t *testing.T) {
+	data := testData(Config{MaxNewWeight: 30, MaxReviewWeight: 20})
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		data.Practices = append(data.Practices,
+			testEntry(HistoryEntry{Time: now.Add(-time.Hour)}),
+			reviewed(3, time.Hour*24, time.Hour*48))
+	}
+	count := func() (nNew, nReview int) {
+		for _, e := range data.selectPractice(nil) {
+			if entryState(e) == STATE_NEW {
+				nNew++
+			} else {
+				nReview++
+			}
+		}
+		return
+	}
+	if nNew, nReview := count(); nNew != 3 || nReview != 2 {
+		t.Fatalf("got %d new %d review", nNew, nReview)
+	}
+	data.answerStep(data.Practices[0], GOOD, 0, time.Minute) // a new entry started today
+	if nNew, _ := count(); nNew != 2 {
+		t.Fatalf("got %d new after spending budget", nNew)
+	}
+
+	// a learning entry carried over from yesterday spends the new budget
+	data = testData(Config{MaxNewWeight: 10})
+	yesterday := now.Add(-time.Hour * 24)
+	carried := testEntry(HistoryEntry{Time: yesterday}, HistoryEntry{Time: yesterday, Grade: AGAIN, Interval: time.Minute})
+	data.Practices = []PracticeEntry{carried, testEntry(HistoryEntry{Time: now.Add(-time.Hour)})}
+	if selected := data.selectPractice(nil); len(selected) != 1 || selected[0].PracticeEntry != carried {
+		t.Fatalf("got %d selected", len(selected))
+	}
+	data.answerStep(carried, GOOD, 0, time.Minute)
+	if newWeight, reviewWeight := data.weightOn(now); newWeight != 10 || reviewWeight != 0 {
+		t.Fatalf("got new %d review %d", newWeight, reviewWeight)
+	}
+	if selected := data.selectPractice(nil); len(selected) != 0 {
+		t.Fatalf("new budget spent again by %d entries", len(selected))
+	}
+}
+
+func TestPracticeQueue(t *testing.T) {
+	now := time.Now()
+	queue := new(PracticeQueue)
+	for i := 0; i < 3; i++ {
+		queue.Add(&queueItem{step: i})
+	}
+	item, _ := queue.Next(now)
+	queue.Requeue(item, now.Add(time.Minute))
+	if item, _ := queue.Next(now); item.step != 1 {
+		t.Fatalf("got %d before the step elapsed", item.step)
+	}
+	if item, _ := queue.Next(now.Add(time.Minute)); item.step != 0 {
+		t.Fatalf("got %d after the step elapsed", item.step)
+	}
+	if item, _ := queue.Next(now); item.step != 2 {
+		t.Fatalf("got %d", item.step)
+	}
+	queue.Requeue(item, now.Add(time.Minute))
+	if item, wait := queue.Next(now); item != nil || wait != time.Minute {
+		t.Fatalf("got %v waiting %v", item, wait)
+	}
+}
+
+func TestLessonGate(t *testing.T) {
+	now := time.Now()
+	entry := func(lesson string, level int, suspended bool) PracticeEntry {
+		e := &AudioToWordEntry{
+			HistoryImpl: &HistoryImpl{
+				History:   []HistoryEntry{{Time: now.Add(-time.Hour)}},
+				Suspended: suspended,
+			},
+			word: &Word{AudioFile: lesson + "/word.mp3"},
+		}
+		if level > 0 {
+			e.AddHistory(HistoryEntry{Level: level, Time: now.Add(-time.Hour), Interval: time.Hour * 24})
+		}
+		return e
+	}
+	// lesson -> passed, unpassed, suspended unpassed entries
+	type lessons map[string][3]int
+	for _, c := range []struct {
+		share    float64
+		lessons  lessons
+		unlocked []string
+		locked   string
+	}{
+		{0.5, lessons{"1": {2, 2, 0}, "2": {1, 3, 0}, "3": {0, 4, 0}}, []string{"1", "2"}, "3"},
+		{0.5, lessons{"1": {1, 3, 0}, "2": {4, 0, 0}, "3": {0, 4, 0}}, []string{"1"}, "2"},
+		{0.5, lessons{"1": {2, 0, 5}, "2": {0, 4, 0}, "3": {0, 4, 0}}, []string{"1", "2"}, "3"},
+		{0, lessons{"1": {0, 4, 0}, "2": {0, 4, 0}, "3": {0, 4, 0}}, []string{"1", "2", "3"}, ""},
+	} {
+		data := testData(Config{GateShare: c.share})
+		for lesson, n := range c.lessons {
+			for i := 0; i < n[0]; i++ {
+				data.Practices = append(data.Practices, entry(lesson, 2, false))
+			}
+			for i := 0; i < n[1]; i++ {
+				data.Practices = append(data.Practices, entry(lesson, 0, false))
+			}
+			for i := 0; i < n[2]; i++ {
+				data.Practices = append(data.Practices, entry(lesson, 0, true))
+			}
+		}
+		unlocked, locked := data.unlockedLessons()
+		var got []string
+		for lesson := range unlocked {
+			got = append(got, lesson)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.unlocked) || locked != c.locked {
+			t.Fatalf("%v: got %v locked %q", c.lessons, got, locked)
+		}
+		for _, e := range data.selectPractice(nil) {
+			if entryState(e) == STATE_NEW && !unlocked[e.Lesson().String()] {
+				t.Fatalf("%v: selected new entry of locked lesson %s", c.lessons, e.Lesson())
+			}
+		}
+	}
+}
+
+func TestSortMastered(t *testing.T) {
+	day := time.Hour * 24
+	mastered := reviewed(topLevel+1, 90*day, 200*day)
+	entries := []EntryInfo{
+		{PracticeEntry: reviewed(3, day*4, day*5), late: 0.1},
+		{PracticeEntry: testEntry(HistoryEntry{Time: time.Now()})},
+		{PracticeEntry: mastered, late: 1},
+	}
+	sort.Sort(EntrySorter(entries))
+	if entries[0].PracticeEntry != mastered {
+		t.Fatal("later recheck should sort ahead of a less late review")
+	}
+	if entryState(entries[2]) != STATE_NEW {
+		t.Fatal("new entries should sort last")
+	}
+}
+
+func TestParseCards(t *testing.T) {
+	content := "# grammar\r\nは\ttopic marker\r\n\r\nが\tsubject marker\t2/3\r\nは\ttopic marker\n"
+	cards, err := parseCards(content, "/home/user/book1/lesson5.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 3 || cards[0].Back != "topic marker" || cards[1].LessonName != "2/3" {
+		t.Fatalf("got %+v", cards)
+	}
+	if lesson := cards[0].Lesson().String(); lesson != "5" {
+		t.Fatalf("lesson %s not taken from the file name", lesson)
+	}
+	if lesson := cards[1].Lesson().String(); lesson != "2/3" {
+		t.Fatalf("got lesson %s", lesson)
+	}
+	data := testData(Config{})
+	added := 0
+	for _, card := range cards {
+		if data.AddEntry(card) {
+			added++
+		}
+	}
+	if added != 2 {
+		t.Fatalf("duplicate card added, %d added", added)
+	}
+	if _, err := parseCards("front only\n", ""); err == nil {
+		t.Fatal("expected error for a line without back")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Balancer spreads due dates by adding random fuzz to intervals and moving them
+// toward the day with the fewest reviews
+type Balancer struct {
+	rand   *rand.Rand
+	fuzz   float64 // max fraction of an interval added or removed at random
+	window float64 // max fraction of an interval a due date may move
+	day    func(time.Time) int64
+	load   map[int64]int
+}
+
+func NewBalancer(seed int64, fuzz, window float64, day func(time.Time) int64) *Balancer {
+	return &Balancer{
+		rand:   rand.New(rand.NewSource(seed)),
+		fuzz:   fuzz,
+		window: window,
+		day:    day,
+		load:   make(map[int64]int),
+	}
+}
+
+func (b *Balancer) Add(due time.Time) {
+	b.load[b.day(due)]++
+}
+
+func (b *Balancer) Adjust(now time.Time, interval time.Duration) time.Duration {
+	if interval < time.Hour*24*2 {
+		return interval
+	}
+	// fuzz
+	if b.fuzz > 0 {
+		delta := float64(interval) * b.fuzz
+		interval += time.Duration((b.rand.Float64()*2 - 1) * delta)
+	}
+	// balance
+	due := now.Add(interval)
+	dueDay := b.day(due)
+	bestDay := dueDay
+	maxShift := int64(float64(interval) * b.window / float64(time.Hour*24))
+	for shift := int64(1); shift <= maxShift; shift++ { // nearest day wins ties
+		for _, day := range []int64{dueDay - shift, dueDay + shift} {
+			if b.load[day] < b.load[bestDay] {
+				bestDay = day
+			}
+		}
+	}
+	interval += time.Duration(bestDay-dueDay) * time.Hour * 24
+	b.load[bestDay]++
+	return interval
+}
+
+func (d *Data) newBalancer() *Balancer {
+	fuzz := d.Config.Fuzz
+	if fuzz == 0 {
+		fuzz = 0.05
+	}
+	window := d.Config.BalanceWindow
+	if window == 0 {
+		window = 0.1
+	}
+	b := NewBalancer(time.Now().UnixNano(), fuzz, window, d.day.Number)
+	now := time.Now()
+	for _, e := range d.Practices {
+		if due := d.due(e); due.After(now) {
+			b.Add(due)
+		}
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+func init() {
+	commandHandlers["confusions"] = ListConfusions
+}
+
+const choiceCount = 4
+
+// distractors returns up to n other words to choose from, taken from the same lesson
+// as the word at index or the nearest lessons
+func (d *Data) distractors(index, n int) []int {
+	lessons := make([]Lesson, len(d.Words))
+	var ordered []Lesson
+	seen := make(map[string]bool)
+	for i, w := range d.Words {
+		lessons[i] = lessonRule(w.AudioFile)
+		if key := lessons[i].String(); !seen[key] {
+			seen[key] = true
+			ordered = append(ordered, lessons[i])
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Compare(ordered[j]) < 0
+	})
+	rank := make(map[string]int)
+	for i, l := range ordered {
+		rank[l.String()] = i
+	}
+	distance := func(i int) int {
+		d := rank[lessons[i].String()] - rank[lessons[index].String()]
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+
+	answer := strings.TrimSpace(d.Words[index].Text)
+	var candidates []int
+	texts := map[string]bool{answer: true}
+	for _, i := range rand.Perm(len(d.Words)) {
+		text := strings.TrimSpace(d.Words[i].Text)
+		if text == "" || texts[text] {
+			continue
+		}
+		texts[text] = true
+		candidates = append(candidates, i)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return distance(candidates[i]) < distance(candidates[j])
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+func ListConfusions(data *Data, args []string) {
+	for _, e := range data.Practices {
+		choice, ok := e.(*ChoiceEntry)
+		if !ok || len(choice.Confusions) == 0 {
+			continue
+		}
+		counts := make(map[int]int)
+		var confused []int
+		for _, i := range choice.Confusions {
+			if counts[i] == 0 {
+				confused = append(confused, i)
+			}
+			counts[i]++
+		}
+		sort.SliceStable(confused, func(i, j int) bool {
+			return counts[confused[i]] > counts[confused[j]]
+		})
+		var parts []string
+		for _, i := range confused {
+			parts = append(parts, s("%s x%d", data.Words[i].Text, counts[i]))
+		}
+		p("%-20s %s\n", choice.word.Text, strings.Join(parts, ", "))
+	}
+}
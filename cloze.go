@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func init() {
+	commandHandlers["add-cloze"] = AddCloze
+}
+
+type span struct {
+	start, end int
+}
+
+// markedSpans returns the spans marked with {{...}} in text with the markers removed
+func markedSpans(text string) (string, []span) {
+	var spans []span
+	var b strings.Builder
+	for {
+		start := strings.Index(text, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start:], "}}")
+		if end < 0 {
+			break
+		}
+		b.WriteString(text[:start])
+		from := b.Len()
+		b.WriteString(text[start+2 : start+end])
+		spans = append(spans, span{from, b.Len()})
+		text = text[start+end+2:]
+	}
+	b.WriteString(text)
+	return b.String(), spans
+}
+
+func stripCloze(text string) string {
+	text, _ = markedSpans(text)
+	return text
+}
+
+// wordSpans returns the non-overlapping spans of text matching known words, preferring
+// longer matches
+func (d *Data) wordSpans(text string) []span {
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) { // offsets would not match
+		return nil
+	}
+	isLetter := func(r rune) bool {
+		return (unicode.IsLetter(r) || unicode.IsDigit(r)) && runeWidth(r) == 1
+	}
+	bounded := func(start, end int) bool {
+		before := []rune(lower[:start])
+		after := []rune(lower[end:])
+		first := []rune(lower[start:end])
+		last := first[len(first)-1]
+		return !(len(before) > 0 && isLetter(before[len(before)-1]) && isLetter(first[0])) &&
+			!(len(after) > 0 && isLetter(after[0]) && isLetter(last))
+	}
+	var spans []span
+	for _, w := range d.Words {
+		word := strings.ToLower(strings.TrimSpace(w.Text))
+		if word == "" {
+			continue
+		}
+		for offset := 0; ; {
+			i := strings.Index(lower[offset:], word)
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			if bounded(start, start+len(word)) {
+				spans = append(spans, span{start, start + len(word)})
+			}
+			offset = start + len(word)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].end-spans[i].start > spans[j].end-spans[j].start
+	})
+	var picked []span
+	for _, s := range spans {
+		overlap := false
+		for _, p := range picked {
+			if s.start < p.end && p.start < s.end {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			picked = append(picked, s)
+		}
+	}
+	sort.Slice(picked, func(i, j int) bool {
+		return picked[i].start < picked[j].start
+	})
+	return picked
+}
+
+// AddCloze adds a cloze entry for each marked or known word in sentence transcripts
+func AddCloze(data *Data, args []string) {
+	for _, e := range data.Practices {
+		sentence, ok := e.(*SentenceEntry)
+		if !ok || data.Transcripts[sentence.AudioFile] == "" {
+			continue
+		}
+		text, spans := markedSpans(data.Transcripts[sentence.AudioFile])
+		if len(spans) == 0 {
+			spans = data.wordSpans(text)
+		}
+		for _, s := range spans {
+			entry := &ClozeEntry{
+				AudioFile: sentence.AudioFile,
+				Text:      text[:s.start] + "{{" + text[s.start:s.end] + "}}" + text[s.end:],
+				HistoryImpl: &HistoryImpl{
+					History: []HistoryEntry{
+						{
+							Level: 0,
+							Time:  time.Now(),
+						},
+					},
+				},
+			}
+			if data.AddEntry(entry) {
+				p("added ClozeEntry %s\n", entry.Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Scheduler       string
+	TargetRetention float64       // 0 means 0.9
+	LevelBase       float64       // interval growth of the level scheduler, 0 means 2.2
+	LevelFirst      time.Duration // first interval of the level scheduler, 0 means 24h
+	FSRSWeights     []float64     // empty means the default weights
+
+	LapsePolicy string // reset, drop or halve
+	LapseDrop   int    // levels dropped by the drop policy, 0 means 2
+
+	Fuzz          float64 // max fraction of an interval randomized, 0 means 0.05, negative disables
+	BalanceWindow float64 // max fraction of an interval moved for load balancing, 0 means 0.1, negative disables
+
+	BurySiblings map[string]bool // by entry type, missing means true
+
+	LeechThreshold int    // lapses to become a leech, 0 means 8
+	LeechAction    string // tag, suspend or warn
+
+	SlowAnswer time.Duration // good answers slower than this count as hard, 0 disables
+
+	MaxWeight       int // daily, 0 means 500
+	MaxReviewWeight int // daily, 0 means 300
+	MaxNewWeight    int // daily, 0 means 50
+
+	LearningSteps []time.Duration // in-session steps for new and failed entries, empty means 1m,10m
+
+	DayStart string // HH:MM a study day starts at, empty means 00:00
+	Timezone string // IANA name, empty means local
+
+	GateShare float64 // share of a lesson at GateLevel to unlock the next one, 0 disables
+	GateLevel int     // 0 means 1
+
+	LessonRule string // regexp:PATTERN or dirs:N, empty means the first number in the audio path
+
+	MasteredRecheck time.Duration // interval to recheck entries mastered under the level scheduler, 0 means never
+
+	LateCredit  float64 // share of overdue time credited on recall, 0 means 0.5, negative disables
+	LatePenalty float64 // extra levels dropped per interval overdue on failure
+
+	ThrottleOverdue  int // overdue reviews to start cutting new entries, 0 disables
+	PauseOverdue     int // overdue reviews to pause new entries, 0 means twice ThrottleOverdue
+	ThrottleForecast int // reviews due in 7 days to start cutting new entries, 0 disables
+	PauseForecast    int // reviews due in 7 days to pause new entries, 0 means twice ThrottleForecast
+}
+
+func init() {
+	commandHandlers["config"] = SetConfig
+}
+
+func (c Config) check() error {
+	if _, ok := schedulers[c.Scheduler]; c.Scheduler != "" && !ok {
+		return fmt.Errorf("unknown scheduler %s", c.Scheduler)
+	}
+	if c.TargetRetention < 0 || c.TargetRetention >= 1 {
+		return fmt.Errorf("target retention must be in [0, 1)")
+	}
+	if c.LevelBase != 0 && c.LevelBase <= 1 {
+		return fmt.Errorf("level base must be greater than 1")
+	}
+	if c.LevelFirst < 0 {
+		return fmt.Errorf("level first interval must not be negative")
+	}
+	if n := len(c.FSRSWeights); n != 0 && n != len(fsrsDefaultWeights) {
+		return fmt.Errorf("expected %d fsrs weights", len(fsrsDefaultWeights))
+	}
+	switch c.LapsePolicy {
+	case "", "reset", "drop", "halve":
+	default:
+		return fmt.Errorf("unknown lapse policy %s", c.LapsePolicy)
+	}
+	if c.LapseDrop < 0 {
+		return fmt.Errorf("lapse drop must not be negative")
+	}
+	if c.MaxWeight < 0 || c.MaxReviewWeight < 0 || c.MaxNewWeight < 0 {
+		return fmt.Errorf("daily limits must not be negative")
+	}
+	for _, step := range c.LearningSteps {
+		if step <= 0 {
+			return fmt.Errorf("learning steps must be positive")
+		}
+	}
+	if _, err := c.studyDay(); err != nil {
+		return err
+	}
+	if c.GateShare < 0 || c.GateShare > 1 || c.GateLevel < 0 {
+		return fmt.Errorf("gate share must be in [0, 1] and gate level not negative")
+	}
+	if _, err := parseLessonRule(c.LessonRule); err != nil {
+		return err
+	}
+	if c.LateCredit > 1 || c.LatePenalty < 0 {
+		return fmt.Errorf("late credit must not exceed 1 and late penalty must not be negative")
+	}
+	if c.ThrottleOverdue < 0 || c.PauseOverdue < 0 || c.ThrottleForecast < 0 || c.PauseForecast < 0 {
+		return fmt.Errorf("throttle thresholds must not be negative")
+	}
+	if c.MasteredRecheck < 0 {
+		return fmt.Errorf("mastered recheck must not be negative")
+	}
+	if c.LeechThreshold < 0 {
+		return fmt.Errorf("leech threshold must not be negative")
+	}
+	switch c.LeechAction {
+	case "", "tag", "suspend", "warn":
+	default:
+		return fmt.Errorf("unknown leech action %s", c.LeechAction)
+	}
+	return nil
+}
+
+func (c Config) targetRetention() float64 {
+	if c.TargetRetention == 0 {
+		return 0.9
+	}
+	return c.TargetRetention
+}
+
+func (c Config) levelBase() float64 {
+	if c.LevelBase == 0 {
+		return 2.2
+	}
+	return c.LevelBase
+}
+
+func (c Config) levelFirst() time.Duration {
+	if c.LevelFirst == 0 {
+		return time.Hour * 24
+	}
+	return c.LevelFirst
+}
+
+func (c Config) lateCredit() float64 {
+	if c.LateCredit == 0 {
+		return 0.5
+	}
+	return c.LateCredit
+}
+
+func (c Config) fsrsWeights() []float64 {
+	if len(c.FSRSWeights) == 0 {
+		return fsrsDefaultWeights
+	}
+	return c.FSRSWeights
+}
+
+func (c Config) limits() (maxWeight, maxReviewWeight, maxNewWeight int) {
+	maxWeight, maxReviewWeight, maxNewWeight = c.MaxWeight, c.MaxReviewWeight, c.MaxNewWeight
+	if maxWeight == 0 {
+		maxWeight = 500
+	}
+	if maxReviewWeight == 0 {
+		maxReviewWeight = 300
+	}
+	if maxNewWeight == 0 {
+		maxNewWeight = 50
+	}
+	return
+}
+
+func (c Config) learningSteps() []time.Duration {
+	if len(c.LearningSteps) == 0 {
+		return []time.Duration{time.Minute, time.Minute * 10}
+	}
+	return c.LearningSteps
+}
+
+func (c Config) lapseLevel(level int) int {
+	switch c.LapsePolicy {
+	case "drop":
+		drop := c.LapseDrop
+		if drop == 0 {
+			drop = 2
+		}
+		level -= drop
+	case "halve":
+		level /= 2
+	default:
+		level = 0
+	}
+	if level < 0 {
+		level = 0
+	}
+	return level
+}
+
+func SetConfig(data *Data, args []string) {
+	value := reflect.ValueOf(&data.Config).Elem()
+	if len(args) == 0 {
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			p("%-20s %v\n", t.Field(i).Name, value.Field(i).Interface())
+		}
+		return
+	}
+	if len(args) != 2 {
+		log.Fatalf("usage: config [name value | name key=value]")
+	}
+	config := data.Config
+	field := reflect.ValueOf(&config).Elem().FieldByName(args[0])
+	if !field.IsValid() {
+		log.Fatalf("unknown config %s", args[0])
+	}
+	if err := setConfigValue(field, args[1]); err != nil {
+		log.Fatalf("bad value for %s: %v", args[0], err)
+	}
+	if err := config.check(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	data.Config = config
+	p("%s = %v\n", args[0], field.Interface())
+}
+
+func setConfigValue(field reflect.Value, str string) error {
+	switch field.Interface().(type) {
+	case time.Duration:
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, part := range strings.Split(str, ",") {
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setConfigValue(elem, strings.TrimSpace(part)); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		field.Set(slice)
+	case reflect.Map:
+		parts := strings.SplitN(str, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected key=value")
+		}
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setConfigValue(elem, parts[1]); err != nil {
+			return err
+		}
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(field.Type()))
+		}
+		field.SetMapIndex(reflect.ValueOf(parts[0]), elem)
+	case reflect.String:
+		field.SetString(str)
+	case reflect.Int:
+		n, err := strconv.Atoi(str)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported config type %v", field.Type())
+	}
+	return nil
+}
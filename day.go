@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// StudyDay maps times to study days, which start at a configured time of day in a configured timezone
+type StudyDay struct {
+	location *time.Location
+	start    time.Duration
+}
+
+func (c Config) studyDay() (StudyDay, error) {
+	day := StudyDay{
+		location: time.Local,
+	}
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return day, err
+		}
+		day.location = location
+	}
+	if c.DayStart != "" {
+		t, err := time.Parse("15:04", c.DayStart)
+		if err != nil {
+			return day, err
+		}
+		day.start = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return day, nil
+}
+
+func (d *Data) initStudyDay() {
+	day, err := d.Config.studyDay()
+	if err != nil {
+		log.Fatalf("bad day config: %v", err)
+	}
+	d.day = day
+}
+
+func (s StudyDay) shift(t time.Time) time.Time {
+	if s.location == nil {
+		return t.Add(-s.start)
+	}
+	return t.In(s.location).Add(-s.start)
+}
+
+// Number returns the number of the study day t is in
+func (s StudyDay) Number(t time.Time) int64 {
+	return dayNumber(s.shift(t))
+}
+
+// Date returns the date of the study day t is in
+func (s StudyDay) Date(t time.Time) string {
+	return s.shift(t).Format("2006-01-02")
+}
+
+// isDue rounds due times to study days, except for intervals shorter than a day
+func (d *Data) isDue(e PracticeEntry, now time.Time) bool {
+	due := d.due(e)
+	if due.IsZero() {
+		return false
+	}
+	if due.Sub(e.LastHistory().Time) < time.Hour*24 {
+		return due.Before(now)
+	}
+	return d.day.Number(due) <= d.day.Number(now)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+type DiffOp int
+
+const (
+	DIFF_EQUAL   DiffOp = iota
+	DIFF_WRONG          // replaced
+	DIFF_MISSING        // expected but not typed
+	DIFF_EXTRA          // typed but not expected
+)
+
+type DiffPart struct {
+	Op       DiffOp
+	Expected string
+	Actual   string
+}
+
+type Diff struct {
+	Parts []DiffPart
+	Sep   string // between tokens
+}
+
+// diffTokens aligns actual to expected with the fewest edits
+func diffTokens(expected, actual []string) []DiffPart {
+	// edit distance table
+	dist := make([][]int, len(expected)+1)
+	for i := range dist {
+		dist[i] = make([]int, len(actual)+1)
+		dist[i][0] = i
+	}
+	for j := range dist[0] {
+		dist[0][j] = j
+	}
+	for i := 1; i <= len(expected); i++ {
+		for j := 1; j <= len(actual); j++ {
+			cost := 1
+			if expected[i-1] == actual[j-1] {
+				cost = 0
+			}
+			dist[i][j] = min(dist[i-1][j-1]+cost, dist[i-1][j]+1, dist[i][j-1]+1)
+		}
+	}
+	// backtrace
+	var parts []DiffPart
+	i, j := len(expected), len(actual)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && expected[i-1] == actual[j-1] && dist[i][j] == dist[i-1][j-1]:
+			parts = append(parts, DiffPart{DIFF_EQUAL, expected[i-1], actual[j-1]})
+			i--
+			j--
+		case i > 0 && j > 0 && dist[i][j] == dist[i-1][j-1]+1:
+			parts = append(parts, DiffPart{DIFF_WRONG, expected[i-1], actual[j-1]})
+			i--
+			j--
+		case i > 0 && dist[i][j] == dist[i-1][j]+1:
+			parts = append(parts, DiffPart{DIFF_MISSING, expected[i-1], ""})
+			i--
+		default:
+			parts = append(parts, DiffPart{DIFF_EXTRA, "", actual[j-1]})
+			j--
+		}
+	}
+	for l, r := 0, len(parts)-1; l < r; l, r = l+1, r-1 {
+		parts[l], parts[r] = parts[r], parts[l]
+	}
+	return parts
+}
+
+func diffRunes(expected, actual string) []DiffPart {
+	split := func(str string) []string {
+		var tokens []string
+		for _, r := range str {
+			tokens = append(tokens, string(r))
+		}
+		return tokens
+	}
+	return diffTokens(split(expected), split(actual))
+}
+
+// tokenize splits text into lower-cased words without punctuation, taking wide
+// characters as words of their own
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsSpace(r), unicode.IsPunct(r):
+			flush()
+		case runeWidth(r) > 1:
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func editDistance(parts []DiffPart) int {
+	n := 0
+	for _, part := range parts {
+		if part.Op != DIFF_EQUAL {
+			n++
+		}
+	}
+	return n
+}
+
+// suggestGrade grades an answer by edit distance relative to the expected length
+func suggestGrade(parts []DiffPart, expectedLen int) PracticeResult {
+	distance := editDistance(parts)
+	switch {
+	case distance == 0:
+		return GOOD
+	case expectedLen > 0 && float64(distance)/float64(expectedLen) <= 0.25:
+		return HARD
+	}
+	return AGAIN
+}
+
+func strWidth(str string) int {
+	width := 0
+	for _, r := range str {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+type diffRune struct {
+	r  rune
+	op DiffOp
+}
+
+// rows returns the expected and actual rows of a diff, padded to align part by part
+func (d Diff) rows() (expected, actual []diffRune) {
+	for i, part := range d.Parts {
+		width := max(strWidth(part.Expected), strWidth(part.Actual))
+		pad := func(row []diffRune, str string) []diffRune {
+			if i > 0 {
+				for _, r := range d.Sep {
+					row = append(row, diffRune{r, DIFF_EQUAL})
+				}
+			}
+			for _, r := range str {
+				row = append(row, diffRune{r, part.Op})
+			}
+			for w := strWidth(str); w < width; w++ {
+				row = append(row, diffRune{' ', DIFF_EQUAL})
+			}
+			return row
+		}
+		expected = pad(expected, part.Expected)
+		actual = pad(actual, part.Actual)
+	}
+	return
+}
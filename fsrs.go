@@ -0,0 +1,141 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+)
+
+// memory state of an entry under the FSRS model
+type Memory struct {
+	Stability  float64 // days for recall probability to drop to 90%
+	Difficulty float64 // 1 to 10
+	Reviews    int     // number of history entries folded into the state
+	Weights    uint64  // hash of the weights the state was computed with
+}
+
+var fsrsDefaultWeights = []float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031, 1.6474,
+	0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81
+)
+
+type FSRSScheduler struct {
+	Weights   []float64
+	Retention float64
+}
+
+func (s *FSRSScheduler) weightsHash() uint64 {
+	h := fnv.New64a()
+	for _, w := range s.Weights {
+		bits := math.Float64bits(w)
+		for i := 0; i < 64; i += 8 {
+			h.Write([]byte{byte(bits >> i)})
+		}
+	}
+	return h.Sum64()
+}
+
+func fsrsRetrievability(elapsedDays, stability float64) float64 {
+	return math.Pow(1+fsrsFactor*elapsedDays/stability, fsrsDecay)
+}
+
+func (s *FSRSScheduler) initDifficulty(grade PracticeResult) float64 {
+	return clamp(s.Weights[4]-float64(grade-GOOD)*s.Weights[5], 1, 10)
+}
+
+func (s *FSRSScheduler) step(m Memory, grade PracticeResult, elapsedDays float64) Memory {
+	w := s.Weights
+	m.Reviews++
+	if m.Stability == 0 { // first answer
+		m.Stability = w[grade-AGAIN]
+		m.Difficulty = s.initDifficulty(grade)
+		return m
+	}
+	r := fsrsRetrievability(elapsedDays, m.Stability)
+	if grade == AGAIN {
+		m.Stability = w[11] * math.Pow(m.Difficulty, -w[12]) *
+			(math.Pow(m.Stability+1, w[13]) - 1) * math.Exp(w[14]*(1-r))
+	} else {
+		bonus := 1.0
+		if grade == HARD {
+			bonus = w[15]
+		} else if grade == EASY {
+			bonus = w[16]
+		}
+		m.Stability *= 1 + math.Exp(w[8])*(11-m.Difficulty)*math.Pow(m.Stability, -w[9])*
+			(math.Exp(w[10]*(1-r))-1)*bonus
+	}
+	difficulty := m.Difficulty - w[6]*float64(grade-GOOD)
+	m.Difficulty = clamp(w[7]*s.initDifficulty(GOOD)+(1-w[7])*difficulty, 1, 10)
+	return m
+}
+
+func days(d time.Duration) float64 {
+	return float64(d) / float64(time.Hour*24)
+}
+
+// replay rebuilds the memory state from the whole history
+func (s *FSRSScheduler) replay(history []HistoryEntry) Memory {
+	var m Memory
+	for i := 1; i < len(history); i++ {
+		if history[i].synthetic() {
+			continue
+		}
+		m = s.step(m, history[i].grade(), days(history[i].Time.Sub(history[i-1].Time)))
+	}
+	m.Reviews = len(history)
+	m.Weights = s.weightsHash()
+	return m
+}
+
+func (s *FSRSScheduler) memory(e PracticeEntry) Memory {
+	m := e.GetMemory()
+	if history := e.GetHistory(); m.Reviews != len(history) || m.Weights != s.weightsHash() {
+		m = s.replay(history)
+		e.SetMemory(m)
+	}
+	return m
+}
+
+func (s *FSRSScheduler) interval(stability float64) time.Duration {
+	d := stability / fsrsFactor * (math.Pow(s.Retention, 1/fsrsDecay) - 1)
+	return time.Duration(math.Max(d, 1) * float64(time.Hour*24))
+}
+
+func (s *FSRSScheduler) currentInterval(e PracticeEntry) time.Duration {
+	lastHistory := e.LastHistory()
+	if lastHistory.Interval > 0 || lastHistory.Level == 0 || lastHistory.Relearning {
+		return lastHistory.Interval
+	}
+	return s.interval(s.memory(e).Stability)
+}
+
+func (s *FSRSScheduler) Due(e PracticeEntry) time.Time {
+	return e.LastHistory().Time.Add(s.currentInterval(e))
+}
+
+func (s *FSRSScheduler) Late(e PracticeEntry, now time.Time) float64 {
+	return lateness(e.LastHistory(), s.currentInterval(e), now)
+}
+
+func (s *FSRSScheduler) Next(e PracticeEntry, res PracticeResult, now time.Time) HistoryEntry {
+	lastHistory := e.LastHistory()
+	m := s.step(s.memory(e), res, days(now.Sub(lastHistory.Time)))
+	e.SetMemory(m)
+	if res == AGAIN {
+		return HistoryEntry{
+			Level: 0,
+			Time:  now,
+		}
+	}
+	return HistoryEntry{
+		Level:    lastHistory.Level + 1,
+		Time:     now,
+		Interval: s.interval(m.Stability),
+	}
+}
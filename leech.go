@@ -0,0 +1,53 @@
+package main
+
+func init() {
+	commandHandlers["leeches"] = ListLeeches
+}
+
+// lapses counts failures of entries that had been learned
+func lapses(e PracticeEntry) int {
+	n := 0
+	last := e.GetHistory()[0]
+	for _, h := range e.GetHistory()[1:] {
+		if h.synthetic() {
+			continue
+		}
+		if h.grade() == AGAIN && last.Level > 0 && !last.Relearning {
+			n++
+		}
+		last = h
+	}
+	return n
+}
+
+func (d *Data) isLeech(e PracticeEntry) bool {
+	threshold := d.Config.LeechThreshold
+	if threshold == 0 {
+		threshold = 8
+	}
+	return lapses(e) >= threshold
+}
+
+func (d *Data) onLeech(e PracticeEntry) {
+	switch d.Config.LeechAction {
+	case "", "tag":
+		e.AddTag("leech")
+	case "suspend":
+		e.AddTag("leech")
+		e.SetSuspended(true)
+	}
+}
+
+func ListLeeches(data *Data, args []string) {
+	for _, e := range data.Practices {
+		if !data.isLeech(e) {
+			continue
+		}
+		audioFile, text := e.Describe()
+		var suspended string
+		if e.IsSuspended() {
+			suspended = "suspended"
+		}
+		p("%-12s %-3d %-20s %-20s %s\n", e.Signature(), lapses(e), audioFile, text, suspended)
+	}
+}
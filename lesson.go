@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Lesson is a hierarchical lesson key like book/unit/lesson
+type Lesson []string
+
+func ParseLesson(str string) Lesson {
+	return Lesson(strings.Split(strings.Trim(str, "/"), "/"))
+}
+
+func (l Lesson) String() string {
+	return strings.Join(l, "/")
+}
+
+// Compare orders lessons part by part, comparing runs of digits by value
+func (l Lesson) Compare(o Lesson) int {
+	for i := 0; i < len(l) && i < len(o); i++ {
+		if c := naturalCompare(l[i], o[i]); c != 0 {
+			return c
+		}
+	}
+	return len(l) - len(o)
+}
+
+func (l Lesson) HasPrefix(prefix Lesson) bool {
+	if len(prefix) > len(l) {
+		return false
+	}
+	return l[:len(prefix)].Compare(prefix) == 0
+}
+
+var digitsPattern = regexp.MustCompile("[0-9]+|[^0-9]+")
+
+func naturalCompare(a, b string) int {
+	as := digitsPattern.FindAllString(a, -1)
+	bs := digitsPattern.FindAllString(b, -1)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		if aErr == nil && bErr == nil {
+			if an != bn {
+				return an - bn
+			}
+			continue
+		}
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// LessonRule extracts lessons from audio paths
+type LessonRule func(path string) Lesson
+
+var lessonRule LessonRule
+
+func init() {
+	lessonRule, _ = parseLessonRule("")
+}
+
+// parseLessonRule parses "regexp:PATTERN", using named or numbered groups as lesson parts,
+// or "dirs:N", using the first N directories. Empty means the first run of digits.
+func parseLessonRule(rule string) (LessonRule, error) {
+	switch {
+	case rule == "":
+		return regexpLessonRule(regexp.MustCompile("[0-9]+")), nil
+	case strings.HasPrefix(rule, "regexp:"):
+		pattern, err := regexp.Compile(strings.TrimPrefix(rule, "regexp:"))
+		if err != nil {
+			return nil, err
+		}
+		return regexpLessonRule(pattern), nil
+	case strings.HasPrefix(rule, "dirs:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(rule, "dirs:"))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad directory levels in %s", rule)
+		}
+		return func(path string) Lesson {
+			dirs := ParseLesson(filepath.ToSlash(filepath.Dir(path)))
+			if len(dirs) > n {
+				dirs = dirs[:n]
+			}
+			return dirs
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown lesson rule %s", rule)
+}
+
+func regexpLessonRule(pattern *regexp.Regexp) LessonRule {
+	var groups []int
+	for i, name := range pattern.SubexpNames() {
+		if i > 0 && name != "" {
+			groups = append(groups, i)
+		}
+	}
+	if len(groups) == 0 {
+		for i := 1; i <= pattern.NumSubexp(); i++ {
+			groups = append(groups, i)
+		}
+	}
+	return func(path string) Lesson {
+		match := pattern.FindStringSubmatch(path)
+		if match == nil {
+			return nil
+		}
+		if len(groups) == 0 {
+			return Lesson{match[0]}
+		}
+		var lesson Lesson
+		for _, i := range groups {
+			lesson = append(lesson, match[i])
+		}
+		return lesson
+	}
+}
+
+func (d *Data) matchLessons(e PracticeEntry, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	lesson := e.Lesson()
+	for _, prefix := range prefixes {
+		if lesson.HasPrefix(ParseLesson(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlockedLessons returns the lessons new entries may be introduced from, and the first locked lesson
+func (d *Data) unlockedLessons() (map[string]bool, string) {
+	total := make(map[string]int)
+	passed := make(map[string]int)
+	keys := make(map[string]Lesson)
+	level := d.Config.GateLevel
+	if level == 0 {
+		level = 1
+	}
+	for _, e := range d.Practices {
+		if e.IsSuspended() {
+			continue
+		}
+		lesson := e.Lesson().String()
+		keys[lesson] = e.Lesson()
+		total[lesson]++
+		if e.LastHistory().Level >= level {
+			passed[lesson]++
+		}
+	}
+	var lessons []string
+	for lesson := range total {
+		lessons = append(lessons, lesson)
+	}
+	sort.Slice(lessons, func(i, j int) bool {
+		return keys[lessons[i]].Compare(keys[lessons[j]]) < 0
+	})
+	unlocked := make(map[string]bool)
+	for i, lesson := range lessons {
+		unlocked[lesson] = true
+		if d.Config.GateShare <= 0 {
+			continue
+		}
+		if float64(passed[lesson])/float64(total[lesson]) < d.Config.GateShare && i+1 < len(lessons) {
+			return unlocked, lessons[i+1]
+		}
+	}
+	return unlocked, ""
+}
@@ -25,21 +25,35 @@ type Data struct {
 	Practices    []PracticeEntry
 	SignatureSet map[string]struct{}
 	Words        []*Word
+	Transcripts  map[string]string // sentence audio file to text
+	Config       Config
 	save         func()
+	scheduler    Scheduler
+	balancer     *Balancer
+	day          StudyDay
 }
 
 type HistoryEntry struct {
-	Level int
-	Time  time.Time
+	Level      int
+	Time       time.Time
+	Interval   time.Duration
+	Grade      PracticeResult
+	Relearning bool
+	Latency    time.Duration
+	Note       string // set on synthetic entries that only move the due time
 }
 
 type PracticeResult int
 
 const (
-	LEVEL_UP PracticeResult = iota
-	LEVEL_RESET
+	NONE PracticeResult = iota
+	AGAIN
+	HARD
+	GOOD
+	EASY
 	EXIT
-	NONE
+	BURY
+	SUSPEND
 )
 
 type Word struct {
@@ -63,40 +77,41 @@ func (d *Data) GetWordIndex(audioFile string, text string) int {
 type PracticeEntry interface {
 	Signature() string
 	Init(*Data)
-	Lesson() string
+	Lesson() Lesson
 	PracticeOrder() int
 	Practice(UI, Input) PracticeResult
 	Weight() int
+	Sibling() string
+	Describe() (audioFile, text string)
 
 	LastHistory() HistoryEntry
-	LevelUp()
-	LevelReset()
 	AddHistory(HistoryEntry)
 	GetHistory() []HistoryEntry
+	GetEase() float64
+	SetEase(float64)
+	GetMemory() Memory
+	SetMemory(Memory)
+	HasTag(string) bool
+	AddTag(string)
+	IsSuspended() bool
+	SetSuspended(bool)
+	GetBuried() time.Time
+	SetBuried(time.Time)
 }
 
 type HistoryImpl struct {
-	History []HistoryEntry
+	History   []HistoryEntry
+	Ease      float64
+	Memory    Memory
+	Tags      []string
+	Suspended bool
+	Buried    time.Time // buried for the study day of this time
 }
 
 func (h HistoryImpl) LastHistory() HistoryEntry {
 	return h.History[len(h.History)-1]
 }
 
-func (h *HistoryImpl) LevelUp() {
-	h.History = append(h.History, HistoryEntry{
-		Level: h.LastHistory().Level + 1,
-		Time:  time.Now(),
-	})
-}
-
-func (h *HistoryImpl) LevelReset() {
-	h.History = append(h.History, HistoryEntry{
-		Level: 0,
-		Time:  time.Now(),
-	})
-}
-
 func (h *HistoryImpl) AddHistory(entry HistoryEntry) {
 	h.History = append(h.History, entry)
 }
@@ -105,6 +120,53 @@ func (h HistoryImpl) GetHistory() []HistoryEntry {
 	return h.History
 }
 
+func (h HistoryImpl) GetEase() float64 {
+	return h.Ease
+}
+
+func (h *HistoryImpl) SetEase(ease float64) {
+	h.Ease = ease
+}
+
+func (h HistoryImpl) GetMemory() Memory {
+	return h.Memory
+}
+
+func (h *HistoryImpl) SetMemory(memory Memory) {
+	h.Memory = memory
+}
+
+func (h HistoryImpl) HasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HistoryImpl) AddTag(tag string) {
+	if !h.HasTag(tag) {
+		h.Tags = append(h.Tags, tag)
+	}
+}
+
+func (h HistoryImpl) IsSuspended() bool {
+	return h.Suspended
+}
+
+func (h *HistoryImpl) SetSuspended(suspended bool) {
+	h.Suspended = suspended
+}
+
+func (h HistoryImpl) GetBuried() time.Time {
+	return h.Buried
+}
+
+func (h *HistoryImpl) SetBuried(t time.Time) {
+	h.Buried = t
+}
+
 var (
 	rootPath string
 )
@@ -122,6 +184,7 @@ var commandHandlers = map[string]func(*Data, []string){}
 func main() {
 	data := Data{
 		SignatureSet: make(map[string]struct{}),
+		Transcripts:  make(map[string]string),
 	}
 
 	db, err := gobfile.New(&data, filepath.Join(rootPath, "db.gob"), 47213)
@@ -137,6 +200,12 @@ func main() {
 	for _, e := range data.Practices {
 		e.Init(&data)
 	}
+	data.scheduler = data.newScheduler()
+	data.initStudyDay()
+	lessonRule, err = parseLessonRule(data.Config.LessonRule)
+	if err != nil {
+		log.Fatalf("bad lesson rule: %v", err)
+	}
 
 	cmd := "practice"
 	if len(os.Args) > 1 {
@@ -209,26 +278,53 @@ func (d *Data) Complete([]string) {
 
 func (data *Data) PrintHistory([]string) {
 	counter := make(map[string]int)
+	spent := make(map[string]time.Duration)
 	total := 0
+	var totalSpent time.Duration
 	for _, entry := range data.Practices {
-		for _, h := range entry.GetHistory() {
+		for _, h := range entry.GetHistory()[1:] {
+			if h.synthetic() {
+				continue
+			}
+			date := data.day.Date(h.Time)
+			spent[date] += h.Latency
+			totalSpent += h.Latency
 			if h.Level == 0 {
 				continue
 			}
-			counter[h.Time.Format("2006-01-02")]++
+			counter[date]++
 			total++
 		}
 	}
 	var dates []string
-	for date := range counter {
+	for date := range spent {
 		dates = append(dates, date)
 	}
 	sort.Strings(dates)
 	for _, date := range dates {
-		p("%s %d\n", date, counter[date])
+		p("%s %d %v\n", date, counter[date], spent[date].Round(time.Second))
+	}
+	per, timed := data.averageLatency()
+	p("total %d, %v spent, %v / answer in %d timed answers\n",
+		total, totalSpent.Round(time.Second), per, timed)
+}
+
+// averageLatency returns the average time to answer and the number of answers timed
+func (data *Data) averageLatency() (time.Duration, int) {
+	var sum time.Duration
+	n := 0
+	for _, entry := range data.Practices {
+		for _, h := range entry.GetHistory() {
+			if h.Latency > 0 {
+				sum += h.Latency
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, 0
 	}
-	per := time.Second * 5
-	p("total %d, %v / %v\n", total, per, time.Duration(total)*per)
+	return (sum / time.Duration(n)).Round(time.Millisecond), n
 }
 
 func (d *Data) ListWords([]string) {
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+func init() {
+	commandHandlers["optimize"] = Optimize
+}
+
+type review struct {
+	level   int
+	elapsed float64 // days
+	success bool
+}
+
+// collectReviews returns the spaced reviews in the history of all entries
+func (d *Data) collectReviews() []review {
+	var reviews []review
+	for _, e := range d.Practices {
+		history := e.GetHistory()
+		for i := 1; i < len(history); i++ {
+			last := history[i-1]
+			if last.Level == 0 || last.Relearning || history[i].synthetic() {
+				continue
+			}
+			reviews = append(reviews, review{
+				level:   last.Level,
+				elapsed: days(history[i].Time.Sub(last.Time)),
+				success: history[i].grade() != AGAIN,
+			})
+		}
+	}
+	return reviews
+}
+
+func logLoss(p float64, success bool) float64 {
+	p = clamp(p, 0.0001, 0.9999)
+	if success {
+		return -math.Log(p)
+	}
+	return -math.Log(1 - p)
+}
+
+// minimize searches positive parameters for the minimum of f by scaling one at a time
+func minimize(f func([]float64) float64, params []float64, rounds int) []float64 {
+	x := append([]float64(nil), params...)
+	best := f(x)
+	step := 0.5
+	for round := 0; round < rounds; round++ {
+		improved := false
+		for i := range x {
+			for _, factor := range []float64{1 + step, 1 / (1 + step)} {
+				old := x[i]
+				x[i] = old * factor
+				if loss := f(x); loss < best {
+					best = loss
+					improved = true
+				} else {
+					x[i] = old
+				}
+			}
+		}
+		if !improved {
+			step /= 2
+		}
+	}
+	return x
+}
+
+func Optimize(data *Data, args []string) {
+	switch data.Config.Scheduler {
+	case "", "level":
+		data.optimizeLevel()
+	case "fsrs":
+		data.optimizeFSRS()
+	default:
+		log.Fatalf("optimize: scheduler %s has no parameters to fit", data.Config.Scheduler)
+	}
+}
+
+func confirm(question string) bool {
+	p("%s (y/n) ", question)
+	var answer string
+	fmt.Scanf("%s", &answer)
+	return answer == "y"
+}
+
+// level
+
+// level model: a review at level L recalls with probability 0.9^(elapsed / (first * base^(L-1)))
+func levelStability(params []float64, level int) float64 {
+	return params[0] * math.Pow(params[1], float64(level-1))
+}
+
+func (d *Data) optimizeLevel() {
+	reviews := d.collectReviews()
+	if len(reviews) == 0 {
+		log.Fatalf("optimize: no reviews in history")
+	}
+	nRecalled := 0
+	for _, r := range reviews {
+		if r.success {
+			nRecalled++
+		}
+	}
+	loss := func(params []float64) float64 {
+		if params[1] <= 1 {
+			return math.Inf(1)
+		}
+		sum := 0.0
+		for _, r := range reviews {
+			sum += logLoss(math.Pow(0.9, r.elapsed/levelStability(params, r.level)), r.success)
+		}
+		return sum
+	}
+	params := minimize(loss, []float64{1, 2.2}, 40)
+
+	// report
+	retention := d.Config.targetRetention()
+	scale := math.Log(retention) / math.Log(0.9)
+	report := func(name string, first time.Duration, base float64) {
+		workload := 0.0
+		recall := 0.0
+		n := 0
+		for _, e := range d.Practices {
+			if entryState(e) != STATE_REVIEW {
+				continue
+			}
+			level := e.LastHistory().Level
+			interval := days(first) * math.Pow(base, float64(level-1))
+			workload += 1 / interval
+			recall += math.Pow(0.9, interval/levelStability(params, level))
+			n++
+		}
+		if n > 0 {
+			recall /= float64(n)
+		}
+		p("%-8s base %.2f first %-10v retention %.1f%% workload %.1f/day\n",
+			name, base, first, recall*100, workload)
+	}
+	p("%d reviews, %.1f%% recalled\n", len(reviews), float64(nRecalled)/float64(len(reviews))*100)
+	first := time.Duration(params[0] * scale * float64(time.Hour*24)).Round(time.Minute)
+	report("current", d.Config.levelFirst(), d.Config.levelBase())
+	report("fitted", first, params[1])
+
+	if !confirm("write parameters?") {
+		return
+	}
+	d.Config.LevelFirst = first
+	d.Config.LevelBase = params[1]
+}
+
+// fsrs
+
+func (d *Data) optimizeFSRS() {
+	retention := d.Config.targetRetention()
+	loss := func(weights []float64) float64 {
+		s := &FSRSScheduler{
+			Weights:   weights,
+			Retention: retention,
+		}
+		sum := 0.0
+		for _, e := range d.Practices {
+			history := e.GetHistory()
+			m := Memory{}
+			for i := 1; i < len(history); i++ {
+				if history[i].synthetic() {
+					continue
+				}
+				elapsed := days(history[i].Time.Sub(history[i-1].Time))
+				grade := history[i].grade()
+				if m.Stability > 0 {
+					sum += logLoss(fsrsRetrievability(elapsed, m.Stability), grade != AGAIN)
+				}
+				m = s.step(m, grade, elapsed)
+			}
+		}
+		return sum
+	}
+	current := d.Config.fsrsWeights()
+	weights := minimize(loss, current, 20)
+
+	// report, predicting recall under the fitted model
+	fitted := &FSRSScheduler{
+		Weights:   weights,
+		Retention: retention,
+	}
+	report := func(name string, weights []float64) {
+		s := &FSRSScheduler{
+			Weights:   weights,
+			Retention: retention,
+		}
+		workload := 0.0
+		recall := 0.0
+		n := 0
+		for _, e := range d.Practices {
+			if entryState(e) != STATE_REVIEW {
+				continue
+			}
+			interval := days(s.interval(s.replay(e.GetHistory()).Stability))
+			workload += 1 / interval
+			recall += fsrsRetrievability(interval, fitted.replay(e.GetHistory()).Stability)
+			n++
+		}
+		if n > 0 {
+			recall /= float64(n)
+		}
+		p("%-8s loss %.1f retention %.1f%% workload %.1f/day\n",
+			name, loss(weights), recall*100, workload)
+	}
+	report("current", current)
+	report("fitted", weights)
+	p("%v\n", weights)
+
+	if !confirm("write parameters?") {
+		return
+	}
+	d.Config.FSRSWeights = weights
+}
@@ -1,73 +1,160 @@
 package main
 
 import (
-	"math"
 	"math/rand"
+	"reflect"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nsf/termbox-go"
 )
 
-var (
-	LevelTime = []time.Duration{
-		0,
-	}
+type EntryInfo struct {
+	PracticeEntry
+	late float64
+}
+
+type EntryState int
+
+const (
+	STATE_NEW        EntryState = iota
+	STATE_LEARNING              // failed before ever passing
+	STATE_RELEARNING            // lapsed
+	STATE_MASTERED              // passed the top level, rechecked along with reviews
+	STATE_REVIEW
 )
 
-func init() {
-	base := 2.2
-	for i := 0.0; i < 12; i++ {
-		t := time.Duration(float64(time.Hour*24) * math.Pow(base, i))
-		LevelTime = append(LevelTime, t)
-		//fmt.Printf("%s\n", formatDuration(t))
+func entryState(e PracticeEntry) EntryState {
+	history := e.GetHistory()
+	lastHistory := history[len(history)-1]
+	switch {
+	case lastHistory.Relearning:
+		return STATE_RELEARNING
+	case lastHistory.Level > topLevel:
+		return STATE_MASTERED
+	case lastHistory.Level > 0:
+		return STATE_REVIEW
+	case len(history) == 1:
+		return STATE_NEW
 	}
+	for _, h := range history { // reset before relearning was recorded
+		if h.Level > 0 {
+			return STATE_RELEARNING
+		}
+	}
+	return STATE_LEARNING
 }
 
-type EntryInfo struct {
-	PracticeEntry
-	late float64
+func entryType(e PracticeEntry) string {
+	return reflect.TypeOf(e).Elem().Name()
+}
+
+// siblingsReviewed maps sibling keys to the signature of the entry reviewed on the day of t
+func (data *Data) siblingsReviewed(t time.Time) map[string]string {
+	reviewed := make(map[string]string)
+	day := data.day.Number(t)
+	for _, e := range data.Practices {
+		sibling := e.Sibling()
+		if sibling == "" || len(e.GetHistory()) == 1 {
+			continue
+		}
+		if data.day.Number(e.LastHistory().Time) == day {
+			reviewed[sibling] = e.Signature()
+		}
+	}
+	return reviewed
 }
 
-func (data *Data) getAllPracticeEntries() []EntryInfo {
+func (data *Data) siblingBuried(e PracticeEntry, reviewed map[string]string) bool {
+	sig, ok := reviewed[e.Sibling()]
+	if !ok || sig == e.Signature() {
+		return false
+	}
+	bury, ok := data.Config.BurySiblings[entryType(e)]
+	return bury || !ok
+}
+
+// getAllPracticeEntries returns due entries in lessons with any of the prefixes
+func (data *Data) getAllPracticeEntries(lessons []string) []EntryInfo {
 	var entries []EntryInfo
 	now := time.Now()
+	reviewed := data.siblingsReviewed(now)
 	// filter
 	for _, e := range data.Practices {
-		lastHistory := e.LastHistory()
-		if lastHistory.Time.Add(LevelTime[lastHistory.Level]).Before(now) {
-			var late float64
-			if lastHistory.Level > 0 {
-				late = float64(now.Sub(
-					lastHistory.Time.Add(time.Duration(float64(LevelTime[lastHistory.Level])*1.1)))) /
-					float64(LevelTime[lastHistory.Level])
-			}
+		if !data.matchLessons(e, lessons) {
+			continue
+		}
+		if e.IsSuspended() || data.isBuried(e, now) || data.siblingBuried(e, reviewed) {
+			continue
+		}
+		if data.isDue(e, now) {
 			entries = append(entries, EntryInfo{
 				PracticeEntry: e,
-				late:          late,
+				late:          data.scheduler.Late(e, now),
 			})
 		}
 	}
 	return entries
 }
 
-func (data *Data) PrintStat([]string) {
-	entries := data.getAllPracticeEntries()
-	nReviews := 0
+func (data *Data) PrintStat(args []string) {
+	entries := data.getAllPracticeEntries(args)
 	nLate := 0
+	stateStat := make(map[EntryState]int)
 	levelStat := make(map[int]int)
 	for _, e := range entries {
 		lastHistory := e.LastHistory()
-		if lastHistory.Level > 0 {
-			nReviews++
-		}
 		if e.late > 0 {
 			nLate++
 		}
+		stateStat[entryState(e)]++
 		levelStat[lastHistory.Level]++
 	}
-	p("%d entries to review, %d late\n", nReviews, nLate)
+	p("%d entries to review, %d late\n", stateStat[STATE_REVIEW], nLate)
+	p("%d relearning, %d learning, %d new\n",
+		stateStat[STATE_RELEARNING], stateStat[STATE_LEARNING], stateStat[STATE_NEW])
+	nSuspended := 0
+	nBuried := 0
+	nMastered := 0
+	now := time.Now()
+	for _, e := range data.Practices {
+		if !data.matchLessons(e, args) {
+			continue
+		}
+		if e.IsSuspended() {
+			nSuspended++
+		} else if data.isBuried(e, now) {
+			nBuried++
+		}
+		if entryState(e) == STATE_MASTERED {
+			nMastered++
+		}
+	}
+	p("%d suspended, %d buried, %d mastered\n", nSuspended, nBuried, nMastered)
+	if _, locked := data.unlockedLessons(); locked != "" {
+		p("new entries locked from lesson %s\n", locked)
+	}
+	var spent time.Duration
+	today := data.day.Number(time.Now())
+	for _, e := range data.Practices {
+		for _, h := range e.GetHistory() {
+			if data.day.Number(h.Time) == today {
+				spent += h.Latency
+			}
+		}
+	}
+	per, _ := data.averageLatency()
+	p("%v spent today, about %v to go\n", spent.Round(time.Second), time.Duration(len(entries))*per)
+	maxWeight, maxReviewWeight, maxNewWeight := data.Config.limits()
+	newWeight, reviewWeight := data.weightOn(time.Now())
+	p("budget left: new %d/%d, review %d/%d, total %d/%d\n",
+		maxNewWeight-newWeight, maxNewWeight,
+		maxReviewWeight-reviewWeight, maxReviewWeight,
+		maxWeight-newWeight-reviewWeight, maxWeight)
+	factor, overdue, forecast := data.newEntryFactor(entries, args)
+	p("%d overdue, %d due in 7 days, new entries at %.0f%%\n", overdue, forecast, factor*100)
 	for i := 1; i < 16; i++ {
 		if n := levelStat[i]; n > 0 {
 			p("%d %d\n", i, n)
@@ -75,41 +162,76 @@ func (data *Data) PrintStat([]string) {
 	}
 }
 
-func (data *Data) Practice([]string) {
-	entries := data.getAllPracticeEntries()
+// newOn reports whether e counts as new on the day of t, having passed no answer before that day
+func (data *Data) newOn(e PracticeEntry, t time.Time) bool {
+	day := data.day.Number(t)
+	for _, h := range e.GetHistory()[1:] {
+		if h.Level > 0 && !h.synthetic() && data.day.Number(h.Time) < day {
+			return false
+		}
+	}
+	return true
+}
+
+// weightOn returns the weight of entries introduced and reviewed on the day of t
+func (data *Data) weightOn(t time.Time) (newWeight, reviewWeight int) {
+	day := data.day.Number(t)
+	for _, e := range data.Practices {
+		if len(e.GetHistory()) < 2 || data.day.Number(e.LastHistory().Time) != day {
+			continue
+		}
+		if data.newOn(e, t) {
+			newWeight += e.Weight()
+		} else {
+			reviewWeight += e.Weight()
+		}
+	}
+	return
+}
+
+func (data *Data) Practice(args []string) {
+	selected := data.selectPractice(args)
+	p("%d entries to practice\n", len(selected))
+	runPractice(selected, data)
+}
+
+// selectPractice returns the due entries in lessons to practice within today's budgets
+func (data *Data) selectPractice(args []string) []EntryInfo {
+	entries := data.getAllPracticeEntries(args)
 	// sort
 	sort.Sort(EntrySorter(entries))
 
 	// select
-	maxWeight := 500
-	maxReviewWeight := 300
-	maxNewWeight := 50
-	reviewWeight := 0
-	newWeight := 0
-	weight := 0
+	maxWeight, maxReviewWeight, maxNewWeight := data.Config.limits()
+	factor, _, _ := data.newEntryFactor(entries, args)
+	maxNewWeight = int(float64(maxNewWeight) * factor)
+	now := time.Now()
+	newWeight, reviewWeight := data.weightOn(now)
+	weight := newWeight + reviewWeight
+	unlocked, _ := data.unlockedLessons()
 	var selected []EntryInfo
 	for _, entry := range entries {
 		if weight >= maxWeight {
 			break
 		}
-		lastLevel := entry.LastHistory().Level
-		if lastLevel == 0 && newWeight >= maxNewWeight { // new
+		if entryState(entry) == STATE_NEW && !unlocked[entry.Lesson().String()] { // gated
+			continue
+		}
+		isNew := data.newOn(entry, now)
+		if isNew && newWeight >= maxNewWeight { // new
 			continue
-		} else if lastLevel > 0 && reviewWeight >= maxReviewWeight { // review
+		} else if !isNew && reviewWeight >= maxReviewWeight { // review
 			continue
 		}
 		selected = append(selected, entry)
-		if lastLevel == 0 {
+		if isNew {
 			newWeight += entry.Weight()
-		} else if lastLevel > 0 {
+		} else {
 			reviewWeight += entry.Weight()
 		}
 		weight += entry.Weight()
 	}
-
-	// practice
-	p("%d entries to practice\n", len(selected))
-	runPractice(selected, data)
+	return selected
 }
 
 type UI func(what string, args ...interface{})
@@ -146,22 +268,40 @@ func runPractice(entries []EntryInfo, data *Data) {
 
 	width, height := termbox.Size()
 	printStr := func(line int, str string) {
-		l := 0
-		for _, r := range str {
-			l += runeWidth(r)
-		}
-		x := (width - l) / 2
+		x := (width - strWidth(str)) / 2
 		for _, r := range str {
 			termbox.SetCell(x, line, r, termbox.ColorDefault, termbox.ColorDefault)
 			x += runeWidth(r)
 		}
 	}
+	diffColors := map[DiffOp]termbox.Attribute{
+		DIFF_EQUAL:   termbox.ColorDefault,
+		DIFF_WRONG:   termbox.ColorRed,
+		DIFF_MISSING: termbox.ColorGreen,
+		DIFF_EXTRA:   termbox.ColorYellow,
+	}
+	printDiff := func(line int, row []diffRune) {
+		l := 0
+		for _, c := range row {
+			l += runeWidth(c.r)
+		}
+		x := (width - l) / 2
+		for _, c := range row {
+			termbox.SetCell(x, line, c.r, diffColors[c.op], termbox.ColorDefault)
+			x += runeWidth(c.r)
+		}
+	}
 
 	var hint, text, info string
+	var diff Diff
+	var typing int32
 	redraw := func() {
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
 		printStr(height/2-2, hint)
 		printStr(height/2, text)
+		expected, actual := diff.rows()
+		printDiff(height/2+2, expected)
+		printDiff(height/2+3, actual)
 		printStr(height-1, info)
 		termbox.Flush()
 	}
@@ -174,6 +314,15 @@ func runPractice(entries []EntryInfo, data *Data) {
 			text = args[0].(string)
 		case "set-info":
 			info = args[0].(string)
+		case "set-diff":
+			diff = args[0].(Diff)
+		case "set-typing": // keys are queued rather than dropped while typing text
+			if args[0].(bool) {
+				atomic.StoreInt32(&typing, 1)
+			} else {
+				atomic.StoreInt32(&typing, 0)
+			}
+			return
 		default:
 			panic("unknown ui action")
 		}
@@ -186,8 +335,23 @@ func runPractice(entries []EntryInfo, data *Data) {
 			ev := termbox.PollEvent()
 			switch ev.Type {
 			case termbox.EventKey:
+				key := ev.Ch
+				switch ev.Key {
+				case termbox.KeyEnter:
+					key = '\n'
+				case termbox.KeyBackspace, termbox.KeyBackspace2:
+					key = '\b'
+				case termbox.KeySpace:
+					key = ' '
+				case termbox.KeyEsc:
+					key = 0x1b
+				}
+				if atomic.LoadInt32(&typing) == 1 {
+					keys <- key
+					continue
+				}
 				select {
-				case keys <- ev.Ch:
+				case keys <- key:
 				default:
 				}
 			case termbox.EventResize:
@@ -197,8 +361,11 @@ func runPractice(entries []EntryInfo, data *Data) {
 			}
 		}
 	}()
+	var keyTime time.Time
 	var input Input = func() rune {
-		return <-keys
+		key := <-keys
+		keyTime = time.Now()
+		return key
 	}
 
 	ui("set-hint", "press f to start")
@@ -219,27 +386,109 @@ func runPractice(entries []EntryInfo, data *Data) {
 	}
 
 	// train
-loop:
+	steps := data.Config.learningSteps()
+	queue := new(PracticeQueue)
+	requeue := func(item *queueItem, after time.Duration) {
+		queue.Requeue(item, time.Now().Add(after))
+	}
 	for _, e := range entries {
+		queue.Add(&queueItem{
+			EntryInfo: e,
+		})
+	}
+	reviewed := data.siblingsReviewed(time.Now())
+loop:
+	for queue.Len() > 0 {
+		item, wait := queue.Next(time.Now())
+		if item == nil { // only learning entries left
+			ui("set-text", "")
+			ui("set-diff", Diff{})
+			ui("set-info", "")
+			ui("set-hint", s("next entry in %v, press q to quit", wait.Round(time.Second)))
+			select {
+			case <-time.After(wait):
+			case key := <-keys:
+				if key == 'q' {
+					break loop
+				}
+			}
+			continue
+		}
+		e := item.PracticeEntry
+		if !item.learning && data.siblingBuried(e, reviewed) {
+			continue
+		}
 		ui("set-hint", "")
 		ui("set-text", "")
+		ui("set-diff", Diff{})
 		lastHistory := e.LastHistory()
 		var lateStr string
-		if e.late > 0 {
-			lateStr = s(" late %f", e.late)
+		if item.late > 0 {
+			lateStr = s(" late %f", item.late)
+		}
+		if data.isLeech(e) {
+			lateStr += s(" leech %d lapses", lapses(e))
+		}
+		if item.learning {
+			lateStr += s(" step %d/%d", item.step+1, len(steps))
 		}
 		ui("set-info", s("level %d lesson %s%s", lastHistory.Level, e.Lesson(), lateStr))
+		start := time.Now()
 		res := e.Practice(ui, input)
+		if res == EXIT {
+			break loop
+		}
 		switch res {
-		case LEVEL_UP:
-			e.LevelUp()
+		case NONE:
+			continue
+		case BURY:
+			e.SetBuried(time.Now())
 			save()
-		case LEVEL_RESET:
-			e.LevelReset()
+			continue
+		case SUSPEND:
+			e.SetSuspended(true)
 			save()
-		case EXIT:
-			break loop
+			continue
 		}
+		latency := keyTime.Sub(start)
+		if sibling := e.Sibling(); sibling != "" {
+			reviewed[sibling] = e.Signature()
+		}
+		if !item.learning {
+			if state := entryState(e); state != STATE_NEW && state != STATE_LEARNING {
+				data.Answer(e, res, latency)
+				save()
+				if res != AGAIN || e.IsSuspended() || data.isBuried(e, time.Now()) { // suspended as a leech
+					continue
+				}
+				item.learning = true
+				requeue(item, steps[0])
+				continue
+			}
+			item.learning = true
+		}
+		// learning steps
+		switch res {
+		case AGAIN:
+			item.step = 0
+		case GOOD:
+			item.step++
+		case EASY:
+			item.step = len(steps)
+		}
+		if item.step < len(steps) {
+			data.answerStep(e, res, latency, steps[item.step])
+			save()
+			requeue(item, steps[item.step])
+			continue
+		}
+		// graduate
+		if res == EASY {
+			data.Answer(e, EASY, latency)
+		} else {
+			data.Answer(e, GOOD, latency)
+		}
+		save()
 	}
 
 	wg.Wait()
@@ -255,64 +504,64 @@ func (self EntrySorter) Less(i, j int) bool {
 	left, right := self[i], self[j]
 	leftLastHistory := left.LastHistory()
 	rightLastHistory := right.LastHistory()
-	leftLesson := left.Lesson()
-	rightLesson := right.Lesson()
-	if leftLastHistory.Level == 0 {
-		if rightLastHistory.Level == 0 { // to be remember
-			if len(left.GetHistory()) == 1 && len(right.GetHistory()) == 1 { // pure new entry
-				if leftLesson < rightLesson { // learn earlier lesson first
-					return true
-				} else if leftLesson > rightLesson {
-					return false
-				} else { // same lesson
-					leftTypeOrder := left.PracticeOrder()
-					rightTypeOrder := right.PracticeOrder()
-					if leftTypeOrder < rightTypeOrder {
-						return true
-					} else if leftTypeOrder > rightTypeOrder {
-						return false
-					} else {
-						return leftLastHistory.Time.Before(rightLastHistory.Time)
-					}
-				}
-			} else { // reset entry
-				now := time.Now()
-				return now.Sub(leftLastHistory.Time) < now.Sub(rightLastHistory.Time)
-			}
-		} else {
-			return false
+	lessonOrder := left.Lesson().Compare(right.Lesson())
+	rank := func(e EntryInfo) EntryState {
+		if state := entryState(e); state != STATE_MASTERED {
+			return state
 		}
-	} else {
-		if rightLastHistory.Level == 0 {
+		return STATE_REVIEW // mastered rechecks rank with reviews
+	}
+	leftState := rank(left)
+	rightState := rank(right)
+	if leftState != rightState { // reviews first, then relearning, learning and new entries
+		return leftState > rightState
+	}
+	switch leftState {
+	case STATE_NEW:
+		if lessonOrder < 0 { // learn earlier lesson first
 			return true
-		} else { // review entry
-			if left.late < 0 && right.late < 0 { // both is not late
-				if leftLastHistory.Level < rightLastHistory.Level { // review low level first
+		} else if lessonOrder > 0 {
+			return false
+		} else { // same lesson
+			leftTypeOrder := left.PracticeOrder()
+			rightTypeOrder := right.PracticeOrder()
+			if leftTypeOrder < rightTypeOrder {
+				return true
+			} else if leftTypeOrder > rightTypeOrder {
+				return false
+			} else {
+				return leftLastHistory.Time.Before(rightLastHistory.Time)
+			}
+		}
+	case STATE_REVIEW:
+		if left.late < 0 && right.late < 0 { // both is not late
+			if leftLastHistory.Level < rightLastHistory.Level { // review low level first
+				return true
+			} else if leftLastHistory.Level > rightLastHistory.Level {
+				return false
+			} else if leftLastHistory.Level == rightLastHistory.Level { // same level
+				if lessonOrder < 0 { // review earlier lesson first
 					return true
-				} else if leftLastHistory.Level > rightLastHistory.Level {
+				} else if lessonOrder > 0 {
 					return false
-				} else if leftLastHistory.Level == rightLastHistory.Level { // same level
-					if leftLesson < rightLesson { // review earlier lesson first
+				} else { // same lesson randomize
+					if rand.Intn(2) == 1 { // randomize
 						return true
-					} else if leftLesson > rightLesson {
-						return false
-					} else { // same lesson randomize
-						if rand.Intn(2) == 1 { // randomize
-							return true
-						}
-						return false
 					}
+					return false
 				}
-			} else if left.late > 0 && right.late > 0 && leftLesson == rightLesson { // randomize same lesson
-				if rand.Intn(2) == 1 {
-					return true
-				}
-				return false
-			} else {
-				return left.late > right.late
 			}
+		} else if left.late > 0 && right.late > 0 && lessonOrder == 0 { // randomize same lesson
+			if rand.Intn(2) == 1 {
+				return true
+			}
+			return false
+		} else {
+			return left.late > right.late
 		}
+	default: // failed entry, most recent first
+		now := time.Now()
+		return now.Sub(leftLastHistory.Time) < now.Sub(rightLastHistory.Time)
 	}
 	panic("not here")
-	return false
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+type queueItem struct {
+	EntryInfo
+	due      time.Time
+	seq      int
+	learning bool
+	step     int
+}
+
+// PracticeQueue hands out learning entries as soon as their step has elapsed, then
+// fresh entries in order
+type PracticeQueue struct {
+	fresh    []*queueItem
+	learning learningHeap
+	seq      int
+}
+
+func (q *PracticeQueue) Len() int {
+	return len(q.fresh) + len(q.learning)
+}
+
+func (q *PracticeQueue) Add(item *queueItem) {
+	q.fresh = append(q.fresh, item)
+}
+
+// Requeue schedules an item at a learning step
+func (q *PracticeQueue) Requeue(item *queueItem, due time.Time) {
+	item.due = due
+	item.seq = q.seq
+	q.seq++
+	heap.Push(&q.learning, item)
+}
+
+// Next returns the next item at now, or the time to wait when only learning items are left
+func (q *PracticeQueue) Next(now time.Time) (*queueItem, time.Duration) {
+	if len(q.learning) > 0 && !q.learning[0].due.After(now) {
+		return heap.Pop(&q.learning).(*queueItem), 0
+	}
+	if len(q.fresh) > 0 {
+		item := q.fresh[0]
+		q.fresh = q.fresh[1:]
+		return item, 0
+	}
+	return nil, q.learning[0].due.Sub(now)
+}
+
+// learningHeap orders learning items by due time, then by insertion
+type learningHeap []*queueItem
+
+func (q learningHeap) Len() int { return len(q) }
+
+func (q learningHeap) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q learningHeap) Less(i, j int) bool {
+	if !q[i].due.Equal(q[j].due) {
+		return q[i].due.Before(q[j].due)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q *learningHeap) Push(x interface{}) {
+	*q = append(*q, x.(*queueItem))
+}
+
+func (q *learningHeap) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+type Scheduler interface {
+	// Due returns the time an entry should be practiced again
+	Due(PracticeEntry) time.Time
+	// Late returns how far an entry is behind its schedule, relative to its interval
+	Late(PracticeEntry, time.Time) float64
+	// Next returns the history entry to record for a practice result
+	Next(PracticeEntry, PracticeResult, time.Time) HistoryEntry
+}
+
+var schedulers = map[string]func(*Data) Scheduler{}
+
+// entries passing the top level of the level scheduler are mastered
+const topLevel = 12
+
+func init() {
+	schedulers["level"] = func(data *Data) Scheduler {
+		s := NewLevelScheduler(data.Config.levelFirst(), data.Config.levelBase())
+		s.LateCredit = data.Config.lateCredit()
+		return s
+	}
+	schedulers["sm2"] = func(data *Data) Scheduler {
+		return SM2Scheduler{
+			LateCredit: data.Config.lateCredit(),
+		}
+	}
+	schedulers["fsrs"] = func(data *Data) Scheduler {
+		return &FSRSScheduler{
+			Weights:   data.Config.fsrsWeights(),
+			Retention: data.Config.targetRetention(),
+		}
+	}
+}
+
+func (d *Data) newScheduler() Scheduler {
+	name := d.Config.Scheduler
+	if name == "" {
+		name = "level"
+	}
+	ctor, ok := schedulers[name]
+	if !ok {
+		log.Fatalf("unknown scheduler %s", name)
+	}
+	return ctor(d)
+}
+
+// interval returns the interval scheduled at h, falling back to the original level table
+// for entries recorded before intervals were stored
+func (h HistoryEntry) interval() time.Duration {
+	if h.Interval > 0 || h.Level == 0 || h.Relearning {
+		return h.Interval
+	}
+	return time.Duration(float64(time.Hour*24) * math.Pow(2.2, float64(h.Level-1)))
+}
+
+// grade returns the answer recorded at h, derived from the level for entries
+// recorded before grades were stored
+func (h HistoryEntry) grade() PracticeResult {
+	if h.Grade != NONE || h.synthetic() {
+		return h.Grade
+	}
+	if h.Level > 0 {
+		return GOOD
+	}
+	return AGAIN
+}
+
+func (h HistoryEntry) synthetic() bool {
+	return h.Note != ""
+}
+
+// lastAnswer returns the last history entry that is not synthetic
+func lastAnswer(e PracticeEntry) HistoryEntry {
+	history := e.GetHistory()
+	for i := len(history) - 1; i > 0; i-- {
+		if !history[i].synthetic() {
+			return history[i]
+		}
+	}
+	return history[0]
+}
+
+// credited extends a scheduled interval by a share of the time an entry was overdue
+func credited(scheduled, elapsed time.Duration, credit float64) time.Duration {
+	if elapsed <= scheduled || credit <= 0 {
+		return scheduled
+	}
+	return scheduled + time.Duration(float64(elapsed-scheduled)*credit)
+}
+
+func lateness(lastHistory HistoryEntry, interval time.Duration, now time.Time) float64 {
+	if lastHistory.Level == 0 || lastHistory.Relearning {
+		return 0
+	}
+	return float64(now.Sub(lastHistory.Time.Add(time.Duration(float64(interval)*1.1)))) /
+		float64(interval)
+}
+
+// due returns when an entry should be practiced again, or the zero time for
+// mastered entries without recheck
+func (d *Data) due(e PracticeEntry) time.Time {
+	if entryState(e) == STATE_MASTERED {
+		lastHistory := e.LastHistory()
+		if lastHistory.Interval == 0 {
+			return time.Time{}
+		}
+		return lastHistory.Time.Add(lastHistory.Interval)
+	}
+	return d.scheduler.Due(e)
+}
+
+func (d *Data) Answer(entry PracticeEntry, res PracticeResult, latency time.Duration) {
+	if res == GOOD && d.Config.SlowAnswer > 0 && latency > d.Config.SlowAnswer {
+		res = HARD
+	}
+	now := time.Now()
+	lastHistory := entry.LastHistory()
+	late := d.scheduler.Late(entry, now)
+	h := d.scheduler.Next(entry, res, now)
+	h.Grade = res
+	h.Latency = latency
+	if res == AGAIN && lastHistory.Relearning { // failed again while relearning, not a new lapse
+		h.Level = lastHistory.Level
+		h.Interval = 0
+		h.Relearning = true
+	} else if res == AGAIN && lastHistory.Level > 0 { // lapse
+		h.Level = d.Config.lapseLevel(lastHistory.Level)
+		if late > 0 { // failed overdue
+			h.Level -= int(late * d.Config.LatePenalty)
+			if h.Level < 0 {
+				h.Level = 0
+			}
+		}
+		h.Interval = 0
+		h.Relearning = true
+	} else if h.Level > topLevel {
+		if _, ok := d.scheduler.(*LevelScheduler); ok { // mastered
+			h.Level = topLevel + 1
+			h.Interval = d.Config.MasteredRecheck
+		} else { // only the level table runs out, other intervals keep growing
+			h.Level = topLevel
+		}
+	}
+	if h.Interval > 0 {
+		if d.balancer == nil {
+			d.balancer = d.newBalancer()
+		}
+		h.Interval = d.balancer.Adjust(now, h.Interval)
+	}
+	entry.AddHistory(h)
+	if res == AGAIN && d.isLeech(entry) {
+		d.onLeech(entry)
+	}
+}
+
+// answerStep records an answer at a learning step, keeping the level and holding the
+// scheduled interval back until the entry graduates
+func (d *Data) answerStep(entry PracticeEntry, res PracticeResult, latency, next time.Duration) {
+	lastHistory := entry.LastHistory()
+	entry.AddHistory(HistoryEntry{
+		Level:      lastHistory.Level,
+		Time:       time.Now(),
+		Interval:   next,
+		Grade:      res,
+		Relearning: lastHistory.Relearning,
+		Latency:    latency,
+	})
+}
+
+// level
+
+type LevelScheduler struct {
+	LevelTime  []time.Duration
+	LateCredit float64
+}
+
+func NewLevelScheduler(first time.Duration, base float64) *LevelScheduler {
+	s := &LevelScheduler{
+		LevelTime: []time.Duration{
+			0,
+		},
+	}
+	for i := 0.0; i < topLevel; i++ {
+		t := time.Duration(float64(first) * math.Pow(base, i))
+		s.LevelTime = append(s.LevelTime, t)
+	}
+	return s
+}
+
+func (s *LevelScheduler) Due(e PracticeEntry) time.Time {
+	lastHistory := e.LastHistory()
+	if lastHistory.Relearning {
+		return lastHistory.Time.Add(lastHistory.Interval)
+	}
+	return lastHistory.Time.Add(s.interval(lastHistory))
+}
+
+func (s *LevelScheduler) interval(h HistoryEntry) time.Duration {
+	if h.Interval > 0 {
+		return h.Interval
+	}
+	return s.LevelTime[h.Level]
+}
+
+func (s *LevelScheduler) Late(e PracticeEntry, now time.Time) float64 {
+	lastHistory := e.LastHistory()
+	return lateness(lastHistory, s.interval(lastHistory), now)
+}
+
+func (s *LevelScheduler) Next(e PracticeEntry, res PracticeResult, now time.Time) HistoryEntry {
+	lastHistory := e.LastHistory()
+	level := lastHistory.Level
+	switch res {
+	case AGAIN:
+		level = 0
+	case HARD: // repeat current interval
+		if level == 0 {
+			level = 1
+		}
+	case GOOD:
+		level++
+	case EASY:
+		level += 2
+	}
+	if level >= len(s.LevelTime) { // mastered
+		return HistoryEntry{
+			Level: level,
+			Time:  now,
+		}
+	}
+	interval := s.LevelTime[level]
+	if (res == GOOD || res == EASY) && lastHistory.Level > 0 && !lastHistory.Relearning {
+		scheduled := s.interval(lastHistory)
+		actual := credited(scheduled, now.Sub(lastHistory.Time), s.LateCredit)
+		interval = time.Duration(float64(interval) * float64(actual) / float64(scheduled))
+	}
+	return HistoryEntry{
+		Level:    level,
+		Time:     now,
+		Interval: interval,
+	}
+}
+
+// sm2
+
+const (
+	sm2InitialEase = 2.5
+	sm2MinEase     = 1.3
+)
+
+type SM2Scheduler struct {
+	LateCredit float64
+}
+
+func (s SM2Scheduler) ease(e PracticeEntry) float64 {
+	if ease := e.GetEase(); ease > 0 {
+		return ease
+	}
+	// seed from current level
+	level := e.LastHistory().Level
+	if level == 0 && len(e.GetHistory()) == 1 { // new entry
+		return sm2InitialEase
+	}
+	return math.Min(sm2MinEase+0.2*float64(level), sm2InitialEase)
+}
+
+func (s SM2Scheduler) Due(e PracticeEntry) time.Time {
+	lastHistory := e.LastHistory()
+	return lastHistory.Time.Add(lastHistory.interval())
+}
+
+func (s SM2Scheduler) Late(e PracticeEntry, now time.Time) float64 {
+	lastHistory := e.LastHistory()
+	return lateness(lastHistory, lastHistory.interval(), now)
+}
+
+func (s SM2Scheduler) Next(e PracticeEntry, res PracticeResult, now time.Time) HistoryEntry {
+	quality := float64(res) + 1
+	ease := s.ease(e) + 0.1 - (5-quality)*(0.08+(5-quality)*0.02)
+	if ease < sm2MinEase {
+		ease = sm2MinEase
+	}
+	e.SetEase(ease)
+	if res == AGAIN {
+		return HistoryEntry{
+			Level: 0,
+			Time:  now,
+		}
+	}
+	lastHistory := e.LastHistory()
+	level := lastHistory.Level + 1
+	var interval time.Duration
+	switch {
+	case level == 1:
+		interval = time.Hour * 24
+	case level == 2:
+		interval = time.Hour * 24 * 6
+	case lastHistory.Relearning: // previous interval was dropped on lapse
+		interval = time.Duration(float64(time.Hour*24*6) * math.Pow(ease, float64(level-2)))
+	default:
+		// credit only time overdue past the due date, which vacations may have moved
+		scheduled := lastHistory.interval()
+		overdue := credited(scheduled, now.Sub(lastHistory.Time), s.LateCredit) - scheduled
+		interval = time.Duration(float64(lastAnswer(e).interval()+overdue) * ease)
+	}
+	switch res {
+	case HARD:
+		interval = time.Duration(math.Max(float64(interval)/2, float64(time.Hour*24)))
+	case EASY:
+		interval = time.Duration(float64(interval) * 1.3)
+	}
+	return HistoryEntry{
+		Level:    level,
+		Time:     now,
+		Interval: interval,
+	}
+}
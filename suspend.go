@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+func init() {
+	commandHandlers["suspended"] = ListSuspended
+	commandHandlers["buried"] = ListBuried
+	commandHandlers["unsuspend"] = Unsuspend
+	commandHandlers["unbury"] = Unbury
+}
+
+func (d *Data) isBuried(e PracticeEntry, now time.Time) bool {
+	buried := e.GetBuried()
+	return !buried.IsZero() && d.day.Number(buried) == d.day.Number(now)
+}
+
+func printEntry(e PracticeEntry) {
+	audioFile, text := e.Describe()
+	p("%-12s %-20s %s\n", e.Signature(), audioFile, text)
+}
+
+// selectEntries returns the entries matching the signatures in args, or all entries for "all"
+func (d *Data) selectEntries(args []string, match func(PracticeEntry) bool) []PracticeEntry {
+	if len(args) == 0 {
+		log.Fatalf("expected signatures or all")
+	}
+	signatures := make(map[string]bool)
+	for _, arg := range args {
+		signatures[arg] = true
+	}
+	var entries []PracticeEntry
+	for _, e := range d.Practices {
+		if match(e) && (signatures["all"] || signatures[e.Signature()]) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+func ListSuspended(data *Data, args []string) {
+	for _, e := range data.Practices {
+		if e.IsSuspended() {
+			printEntry(e)
+		}
+	}
+}
+
+func ListBuried(data *Data, args []string) {
+	now := time.Now()
+	for _, e := range data.Practices {
+		if data.isBuried(e, now) {
+			printEntry(e)
+		}
+	}
+}
+
+func Unsuspend(data *Data, args []string) {
+	entries := data.selectEntries(args, PracticeEntry.IsSuspended)
+	for _, e := range entries {
+		e.SetSuspended(false)
+	}
+	p("%d entries unsuspended\n", len(entries))
+}
+
+func Unbury(data *Data, args []string) {
+	now := time.Now()
+	entries := data.selectEntries(args, func(e PracticeEntry) bool {
+		return data.isBuried(e, now)
+	})
+	for _, e := range entries {
+		e.SetBuried(time.Time{})
+	}
+	p("%d entries unburied\n", len(entries))
+}
@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// throttle scales from 1 at soft down to 0 at hard, soft 0 disables
+func throttle(n, soft, hard int) float64 {
+	if soft <= 0 || n <= soft {
+		return 1
+	}
+	if hard <= soft {
+		hard = soft * 2
+	}
+	if n >= hard {
+		return 0
+	}
+	return float64(hard-n) / float64(hard-soft)
+}
+
+// newEntryFactor returns the share of the new entry budget to use given the number of
+// overdue reviews in due and the number of reviews forecast for the next 7 days, both
+// counted in the given lessons
+func (d *Data) newEntryFactor(due []EntryInfo, lessons []string) (factor float64, overdue, forecast int) {
+	for _, e := range due {
+		if e.late > 0 && entryState(e) != STATE_MASTERED {
+			overdue++
+		}
+	}
+	now := time.Now()
+	end := now.Add(time.Hour * 24 * 7)
+	for _, e := range d.Practices {
+		if e.IsSuspended() || len(e.GetHistory()) == 1 || !d.matchLessons(e, lessons) {
+			continue
+		}
+		if due := d.due(e); due.After(now) && due.Before(end) {
+			forecast++
+		}
+	}
+	c := d.Config
+	factor = throttle(overdue, c.ThrottleOverdue, c.PauseOverdue)
+	if f := throttle(forecast, c.ThrottleForecast, c.PauseForecast); f < factor {
+		factor = f
+	}
+	return
+}
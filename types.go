@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/gob"
-	"regexp"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"unicode"
 )
 
 func init() {
@@ -10,11 +13,64 @@ func init() {
 	gob.Register(new(WordToAudioEntry))
 	gob.Register(new(SentenceEntry))
 	gob.Register(new(DialogEntry))
+	gob.Register(new(TypedWordEntry))
+	gob.Register(new(DictationEntry))
+	gob.Register(new(ClozeEntry))
+	gob.Register(new(ChoiceEntry))
+	gob.Register(new(TextCardEntry))
 }
 
-var (
-	lessonPattern = regexp.MustCompile("[0-9]+")
-)
+const gradeHint = "press T again, H hard, G good, E easy, Space to repeat, B bury, S suspend"
+
+func gradeKey(key rune) PracticeResult {
+	switch key {
+	case 't':
+		return AGAIN
+	case 'h':
+		return HARD
+	case 'g':
+		return GOOD
+	case 'e':
+		return EASY
+	case 'q':
+		return EXIT
+	case 'b':
+		return BURY
+	case 's':
+		return SUSPEND
+	}
+	return NONE
+}
+
+var resultNames = map[PracticeResult]string{
+	AGAIN: "again",
+	HARD:  "hard",
+	GOOD:  "good",
+	EASY:  "easy",
+}
+
+// readLine reads typed text until Enter, or returns false on Esc
+func readLine(ui UI, input Input) (string, bool) {
+	ui("set-typing", true)
+	defer ui("set-typing", false)
+	var line []rune
+	for {
+		ui("set-text", string(line))
+		switch r := input(); r {
+		case '\n':
+			return string(line), true
+		case 0x1b:
+			return "", false
+		case '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case 0:
+		default:
+			line = append(line, r)
+		}
+	}
+}
 
 // audio to word
 
@@ -32,8 +88,8 @@ func (e *AudioToWordEntry) Init(data *Data) {
 	e.word = data.Words[e.WordIndex]
 }
 
-func (e *AudioToWordEntry) Lesson() string {
-	return lessonPattern.FindStringSubmatch(e.word.AudioFile)[0]
+func (e *AudioToWordEntry) Lesson() Lesson {
+	return lessonRule(e.word.AudioFile)
 }
 
 func (e *AudioToWordEntry) PracticeOrder() int {
@@ -44,6 +100,14 @@ func (e *AudioToWordEntry) Weight() int {
 	return 10
 }
 
+func (e *AudioToWordEntry) Sibling() string {
+	return s("word-%d", e.WordIndex)
+}
+
+func (e *AudioToWordEntry) Describe() (string, string) {
+	return e.word.AudioFile, e.word.Text
+}
+
 func (e *AudioToWordEntry) Practice(ui UI, input Input) PracticeResult {
 	ui("set-hint", "playing...")
 	playAudio(e.word.AudioFile)
@@ -51,21 +115,18 @@ func (e *AudioToWordEntry) Practice(ui UI, input Input) PracticeResult {
 	input()
 	ui("set-text", e.word.Text)
 repeat:
-	ui("set-hint", "press G to levelup, T to reset level, Space to repeat")
-	key := input()
-	switch key {
-	case 'g':
-		return LEVEL_UP
-	case 't':
-		return LEVEL_RESET
-	case 'q':
+	ui("set-hint", gradeHint)
+	switch res := gradeKey(input()); res {
+	case EXIT:
 		ui("set-hint", "exit...")
 		return EXIT
-	default:
+	case NONE:
 		ui("set-hint", "playing...")
 		playAudio(e.word.AudioFile)
 		ui("set-hint", "")
 		goto repeat
+	default:
+		return res
 	}
 }
 
@@ -85,8 +146,8 @@ func (e *WordToAudioEntry) Init(data *Data) {
 	e.word = data.Words[e.WordIndex]
 }
 
-func (e *WordToAudioEntry) Lesson() string {
-	return lessonPattern.FindStringSubmatch(e.word.AudioFile)[0]
+func (e *WordToAudioEntry) Lesson() Lesson {
+	return lessonRule(e.word.AudioFile)
 }
 
 func (e *WordToAudioEntry) PracticeOrder() int {
@@ -97,6 +158,14 @@ func (e *WordToAudioEntry) Weight() int {
 	return 10
 }
 
+func (e *WordToAudioEntry) Sibling() string {
+	return s("word-%d", e.WordIndex)
+}
+
+func (e *WordToAudioEntry) Describe() (string, string) {
+	return e.word.AudioFile, e.word.Text
+}
+
 func (e *WordToAudioEntry) Practice(ui UI, input Input) PracticeResult {
 	ui("set-text", e.word.Text)
 	ui("set-hint", "press any key to play audio")
@@ -104,18 +173,15 @@ func (e *WordToAudioEntry) Practice(ui UI, input Input) PracticeResult {
 repeat:
 	ui("set-hint", "playing...")
 	playAudio(e.word.AudioFile)
-	ui("set-hint", "press G to levelup, T to reset level, Space to repeat")
-	key := input()
-	switch key {
-	case 'g':
-		return LEVEL_UP
-	case 't':
-		return LEVEL_RESET
-	case 'q':
+	ui("set-hint", gradeHint)
+	switch res := gradeKey(input()); res {
+	case EXIT:
 		ui("set-hint", "exit...")
 		return EXIT
-	default:
+	case NONE:
 		goto repeat
+	default:
+		return res
 	}
 }
 
@@ -127,29 +193,34 @@ func (sen sentenceCommon) Signature() string {
 	return s("sen-%s", sen)
 }
 
-func (s sentenceCommon) Lesson() string {
-	return lessonPattern.FindStringSubmatch(string(s))[0]
+func (s sentenceCommon) Sibling() string {
+	return "sentence-" + string(s)
+}
+
+func (s sentenceCommon) Describe() (string, string) {
+	return string(s), ""
+}
+
+func (s sentenceCommon) Lesson() Lesson {
+	return lessonRule(string(s))
 }
 
 func (s sentenceCommon) Practice(ui UI, input Input) PracticeResult {
 	ui("set-hint", "playing...")
 	playAudio(string(s))
 repeat:
-	ui("set-hint", "press G to levelup, T to reset level, Space to repeat")
-	key := input()
-	switch key {
-	case 'g':
-		return LEVEL_UP
-	case 't':
-		return LEVEL_RESET
-	case 'q':
+	ui("set-hint", gradeHint)
+	switch res := gradeKey(input()); res {
+	case EXIT:
 		ui("set-hint", "exit...")
 		return EXIT
-	default:
+	case NONE:
 		ui("set-hint", "playing...")
 		playAudio(string(s))
 		ui("set-hint", "")
 		goto repeat
+	default:
+		return res
 	}
 }
 
@@ -192,3 +263,324 @@ func (e *DialogEntry) PracticeOrder() int {
 func (e *DialogEntry) Weight() int {
 	return 10
 }
+
+// typed word
+
+type TypedWordEntry struct {
+	*HistoryImpl
+	WordIndex int
+	word      *Word
+}
+
+func (e *TypedWordEntry) Signature() string {
+	return s("typ-%d", e.WordIndex)
+}
+
+func (e *TypedWordEntry) Init(data *Data) {
+	e.word = data.Words[e.WordIndex]
+}
+
+func (e *TypedWordEntry) Lesson() Lesson {
+	return lessonRule(e.word.AudioFile)
+}
+
+func (e *TypedWordEntry) PracticeOrder() int {
+	return 5
+}
+
+func (e *TypedWordEntry) Weight() int {
+	return 10
+}
+
+func (e *TypedWordEntry) Sibling() string {
+	return s("word-%d", e.WordIndex)
+}
+
+func (e *TypedWordEntry) Describe() (string, string) {
+	return e.word.AudioFile, e.word.Text
+}
+
+func (e *TypedWordEntry) Practice(ui UI, input Input) PracticeResult {
+	return typedAnswer(ui, input, e.word.AudioFile, "type the word", func(typed string) (Diff, PracticeResult) {
+		expected := strings.TrimSpace(e.word.Text)
+		parts := diffRunes(expected, strings.TrimSpace(typed))
+		return Diff{Parts: parts}, suggestGrade(parts, len([]rune(expected)))
+	})
+}
+
+// typedAnswer plays audio, reads a typed answer and shows its diff, returning the
+// suggested grade on Enter or the grade pressed
+func typedAnswer(ui UI, input Input, audioFile, prompt string, check func(string) (Diff, PracticeResult)) PracticeResult {
+	ui("set-hint", "playing...")
+	playAudio(audioFile)
+	ui("set-hint", prompt+", Enter to check, Esc to give up")
+	typed, ok := readLine(ui, input)
+	if !ok {
+		typed = ""
+	}
+	diff, suggested := check(typed)
+	ui("set-text", "")
+	ui("set-diff", diff)
+repeat:
+	ui("set-hint", s("suggested %s, Enter to accept, or %s", resultNames[suggested], gradeHint))
+	switch key := input(); key {
+	case '\n':
+		return suggested
+	default:
+		switch res := gradeKey(key); res {
+		case EXIT:
+			ui("set-hint", "exit...")
+			return EXIT
+		case NONE:
+			ui("set-hint", "playing...")
+			playAudio(audioFile)
+			goto repeat
+		default:
+			return res
+		}
+	}
+}
+
+// dictation
+
+type DictationEntry struct {
+	*HistoryImpl
+	AudioFile  string
+	transcript string
+}
+
+func (e *DictationEntry) Signature() string {
+	return s("dic-%s", e.AudioFile)
+}
+
+func (e *DictationEntry) Init(data *Data) {
+	e.transcript = stripCloze(data.Transcripts[e.AudioFile])
+}
+
+func (e *DictationEntry) Lesson() Lesson {
+	return lessonRule(e.AudioFile)
+}
+
+func (e *DictationEntry) PracticeOrder() int {
+	return 6
+}
+
+func (e *DictationEntry) Weight() int {
+	return 10
+}
+
+func (e *DictationEntry) Sibling() string {
+	return "sentence-" + e.AudioFile
+}
+
+func (e *DictationEntry) Describe() (string, string) {
+	return e.AudioFile, e.transcript
+}
+
+func (e *DictationEntry) Practice(ui UI, input Input) PracticeResult {
+	return typedAnswer(ui, input, e.AudioFile, "type the sentence", func(typed string) (Diff, PracticeResult) {
+		expected := tokenize(e.transcript)
+		parts := diffTokens(expected, tokenize(typed))
+		sep := ""
+		if strings.IndexFunc(e.transcript, unicode.IsSpace) >= 0 {
+			sep = " "
+		}
+		return Diff{Parts: parts, Sep: sep}, suggestGrade(parts, len(expected))
+	})
+}
+
+// cloze
+
+type ClozeEntry struct {
+	*HistoryImpl
+	AudioFile string
+	Text      string // transcript with the gap marked by {{...}}
+}
+
+func (e *ClozeEntry) Signature() string {
+	return s("clz-%s-%s", e.AudioFile, e.Text)
+}
+
+func (e *ClozeEntry) Init(*Data) {
+}
+
+func (e *ClozeEntry) Lesson() Lesson {
+	return lessonRule(e.AudioFile)
+}
+
+func (e *ClozeEntry) PracticeOrder() int {
+	return 7
+}
+
+func (e *ClozeEntry) Weight() int {
+	return 10
+}
+
+func (e *ClozeEntry) Sibling() string {
+	return "sentence-" + e.AudioFile
+}
+
+func (e *ClozeEntry) Describe() (string, string) {
+	return e.AudioFile, e.Text
+}
+
+func (e *ClozeEntry) Practice(ui UI, input Input) PracticeResult {
+	text, spans := markedSpans(e.Text)
+	gap := spans[0]
+	answer := text[gap.start:gap.end]
+	ui("set-text", text[:gap.start]+strings.Repeat("_", strWidth(answer))+text[gap.end:])
+	ui("set-hint", "playing...")
+	playAudio(e.AudioFile)
+	ui("set-hint", "press any key to show answer")
+	input()
+	ui("set-text", text[:gap.start]+"["+answer+"]"+text[gap.end:])
+repeat:
+	ui("set-hint", gradeHint)
+	switch res := gradeKey(input()); res {
+	case EXIT:
+		ui("set-hint", "exit...")
+		return EXIT
+	case NONE:
+		ui("set-hint", "playing...")
+		playAudio(e.AudioFile)
+		ui("set-hint", "")
+		goto repeat
+	default:
+		return res
+	}
+}
+
+// multiple choice
+
+type ChoiceEntry struct {
+	*HistoryImpl
+	WordIndex  int
+	Confusions []int // indexes of words chosen wrongly
+	word       *Word
+	data       *Data
+}
+
+func (e *ChoiceEntry) Signature() string {
+	return s("cho-%d", e.WordIndex)
+}
+
+func (e *ChoiceEntry) Init(data *Data) {
+	e.word = data.Words[e.WordIndex]
+	e.data = data
+}
+
+func (e *ChoiceEntry) Lesson() Lesson {
+	return lessonRule(e.word.AudioFile)
+}
+
+func (e *ChoiceEntry) PracticeOrder() int {
+	return 8
+}
+
+func (e *ChoiceEntry) Weight() int {
+	return 10
+}
+
+func (e *ChoiceEntry) Sibling() string {
+	return s("word-%d", e.WordIndex)
+}
+
+func (e *ChoiceEntry) Describe() (string, string) {
+	return e.word.AudioFile, e.word.Text
+}
+
+func (e *ChoiceEntry) Practice(ui UI, input Input) PracticeResult {
+	choices := append(e.data.distractors(e.WordIndex, choiceCount-1), e.WordIndex)
+	rand.Shuffle(len(choices), func(i, j int) {
+		choices[i], choices[j] = choices[j], choices[i]
+	})
+	var options []string
+	for i, index := range choices {
+		options = append(options, s("%d %s", i+1, e.data.Words[index].Text))
+	}
+	ui("set-text", strings.Join(options, "   "))
+	ui("set-hint", "playing...")
+	playAudio(e.word.AudioFile)
+repeat:
+	ui("set-hint", s("press 1-%d to choose, Space to repeat, Q exit, B bury, S suspend", len(choices)))
+	key := input()
+	if n := int(key - '1'); n >= 0 && n < len(choices) {
+		if choices[n] == e.WordIndex {
+			return GOOD
+		}
+		e.Confusions = append(e.Confusions, choices[n])
+		ui("set-text", s("%s, not %s", e.word.Text, e.data.Words[choices[n]].Text))
+		ui("set-hint", "press any key to continue")
+		input()
+		return AGAIN
+	}
+	switch res := gradeKey(key); res {
+	case EXIT:
+		ui("set-hint", "exit...")
+		return EXIT
+	case BURY, SUSPEND:
+		return res
+	case NONE:
+		ui("set-hint", "playing...")
+		playAudio(e.word.AudioFile)
+	}
+	goto repeat
+}
+
+// text card
+
+type TextCardEntry struct {
+	*HistoryImpl
+	Front      string
+	Back       string
+	LessonName string // lesson given in the card file, otherwise taken from the name of Source
+	Source     string // card file
+}
+
+func (e *TextCardEntry) Signature() string {
+	return s("card-%s\t%s", e.Front, e.Back)
+}
+
+func (e *TextCardEntry) Init(*Data) {
+}
+
+func (e *TextCardEntry) Lesson() Lesson {
+	if e.LessonName != "" {
+		return ParseLesson(e.LessonName)
+	}
+	return lessonRule(filepath.Base(e.Source))
+}
+
+func (e *TextCardEntry) PracticeOrder() int {
+	return 9
+}
+
+func (e *TextCardEntry) Weight() int {
+	return 10
+}
+
+func (e *TextCardEntry) Sibling() string {
+	return ""
+}
+
+func (e *TextCardEntry) Describe() (string, string) {
+	return e.Source, e.Front + " / " + e.Back
+}
+
+func (e *TextCardEntry) Practice(ui UI, input Input) PracticeResult {
+	ui("set-text", e.Front)
+	ui("set-hint", "press any key to show answer")
+	input()
+	ui("set-text", e.Front+" / "+e.Back)
+	ui("set-hint", "press T again, H hard, G good, E easy, B bury, S suspend")
+	for {
+		switch res := gradeKey(input()); res {
+		case EXIT:
+			ui("set-hint", "exit...")
+			return EXIT
+		case NONE:
+		default:
+			return res
+		}
+	}
+}
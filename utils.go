@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -43,3 +44,13 @@ func formatDuration(duration time.Duration) string {
 	}
 	return ret
 }
+
+func clamp(f, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, f))
+}
+
+// dayNumber returns the number of the calendar day t is in, in the location of t
+func dayNumber(t time.Time) int64 {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (60 * 60 * 24)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func init() {
+	commandHandlers["vacation"] = Vacation
+	commandHandlers["reschedule"] = Reschedule
+}
+
+// moveDue records a synthetic history entry that only changes the due time of an entry
+func moveDue(e PracticeEntry, due time.Time, note string) {
+	h := e.LastHistory()
+	h.Interval = due.Sub(h.Time)
+	h.Grade = NONE
+	h.Latency = 0
+	h.Note = note
+	e.AddHistory(h)
+}
+
+func (d *Data) parseDate(str string) time.Time {
+	location := d.day.location
+	if location == nil {
+		location = time.Local
+	}
+	t, err := time.ParseInLocation("2006-01-02", str, location)
+	if err != nil {
+		log.Fatalf("expected date like 2006-01-02, not %s", str)
+	}
+	return t.Add(d.day.start)
+}
+
+func Vacation(data *Data, args []string) {
+	if len(args) != 2 {
+		log.Fatalf("usage: vacation first-day last-day")
+	}
+	start := data.parseDate(args[0])
+	end := data.parseDate(args[1]).Add(time.Hour * 24)
+	if !end.After(start) {
+		log.Fatalf("vacation ends before it starts")
+	}
+	note := s("vacation %s..%s", args[0], args[1])
+	n := 0
+	for _, e := range data.Practices {
+		if entryState(e) != STATE_REVIEW {
+			continue
+		}
+		due := data.due(e)
+		if due.Before(start) { // overdue before leaving
+			continue
+		}
+		moveDue(e, due.Add(end.Sub(start)), note)
+		n++
+	}
+	p("%d entries moved by %v\n", n, end.Sub(start))
+}
+
+func Reschedule(data *Data, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("usage: reschedule days")
+	}
+	nDays, err := strconv.Atoi(args[0])
+	if err != nil || nDays < 1 {
+		log.Fatalf("expected number of days, not %s", args[0])
+	}
+	var backlog []EntryInfo
+	for _, e := range data.getAllPracticeEntries(nil) {
+		if entryState(e) == STATE_REVIEW && e.late > 0 {
+			backlog = append(backlog, e)
+		}
+	}
+	sort.Sort(EntrySorter(backlog))
+	now := time.Now()
+	note := s("reschedule %d days", nDays)
+	moved := 0
+	for i, e := range backlog {
+		offset := i * nDays / len(backlog)
+		if offset == 0 { // stay due today
+			continue
+		}
+		moveDue(e.PracticeEntry, now.Add(time.Duration(offset)*time.Hour*24), note)
+		moved++
+	}
+	p("%d late entries, %d moved over %d days\n", len(backlog), moved, nDays)
+}